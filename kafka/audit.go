@@ -0,0 +1,168 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit header names, relative to AuditConfig.HeaderPrefix
+const (
+	auditHeaderProducer      = "producer"
+	auditHeaderHost          = "host"
+	auditHeaderGitSHA        = "git-sha"
+	auditHeaderSchemaVersion = "schema-version"
+	auditHeaderProducedAt    = "produced-at"
+)
+
+// DefaultAuditHeaderPrefix is the default namespace of audit headers.
+const DefaultAuditHeaderPrefix = "audit."
+
+// AuditConfig configures the audit trail headers stamped by the
+// interceptor returned by NewAuditInterceptor().
+type AuditConfig struct {
+	// HeaderPrefix namespaces the audit headers,
+	// defaults to DefaultAuditHeaderPrefix.
+	HeaderPrefix string
+	// ProducerID identifies the producing application.
+	ProducerID string
+	// Host is the producing host, defaults to os.Hostname().
+	Host string
+	// GitSHA is the source revision of the producing application.
+	GitSHA string
+	// SchemaVersion, if not nil, returns the schema version of msg's value.
+	SchemaVersion func(msg *Message) string
+}
+
+// AuditInfo is the provenance of a message, as stamped in its audit headers.
+// Fields that were not stamped are empty.
+type AuditInfo struct {
+	ProducerID    string
+	Host          string
+	GitSHA        string
+	SchemaVersion string
+	ProducedAt    time.Time
+}
+
+// String returns a human-readable representation of an AuditInfo.
+func (a AuditInfo) String() string {
+	return fmt.Sprintf("AuditInfo(producer %s, host %s, git %s, schema %s, at %v)",
+		a.ProducerID, a.Host, a.GitSHA, a.SchemaVersion, a.ProducedAt)
+}
+
+// auditInterceptor stamps messages with audit headers
+type auditInterceptor struct {
+	config AuditConfig
+}
+
+// NewAuditInterceptor returns a ProduceInterceptor stamping produced
+// messages with the audit trail headers of config, identifying the
+// producing application, host, source revision, schema version and
+// produce time, for end-to-end provenance tracking.
+// See Producer.AddProduceInterceptor() and ParseAuditHeaders()
+//
+// Existing audit headers, e.g., of a forwarded message, are replaced.
+func NewAuditInterceptor(config AuditConfig) (ProduceInterceptor, error) {
+	if config.HeaderPrefix == "" {
+		config.HeaderPrefix = DefaultAuditHeaderPrefix
+	}
+
+	if config.Host == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		config.Host = host
+	}
+
+	return &auditInterceptor{config: config}, nil
+}
+
+// OnProduce implements ProduceInterceptor by replacing the audit headers
+// of msg.
+func (ai *auditInterceptor) OnProduce(msg *Message) error {
+	prefix := ai.config.HeaderPrefix
+
+	var headers []Header
+	for _, hdr := range msg.Headers {
+		if !strings.HasPrefix(hdr.Key, prefix) {
+			headers = append(headers, hdr)
+		}
+	}
+
+	add := func(name string, value string) {
+		if value != "" {
+			headers = append(headers, Header{Key: prefix + name, Value: []byte(value)})
+		}
+	}
+
+	add(auditHeaderProducer, ai.config.ProducerID)
+	add(auditHeaderHost, ai.config.Host)
+	add(auditHeaderGitSHA, ai.config.GitSHA)
+	if ai.config.SchemaVersion != nil {
+		add(auditHeaderSchemaVersion, ai.config.SchemaVersion(msg))
+	}
+	add(auditHeaderProducedAt,
+		strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
+
+	msg.Headers = headers
+
+	return nil
+}
+
+// ParseAuditHeaders returns the provenance of msg from its audit headers
+// namespaced with prefix (DefaultAuditHeaderPrefix if empty),
+// and whether msg has any audit headers.
+func ParseAuditHeaders(msg *Message, prefix string) (info AuditInfo, found bool) {
+	if prefix == "" {
+		prefix = DefaultAuditHeaderPrefix
+	}
+
+	for _, hdr := range msg.Headers {
+		if !strings.HasPrefix(hdr.Key, prefix) {
+			continue
+		}
+
+		value := string(hdr.Value)
+		switch strings.TrimPrefix(hdr.Key, prefix) {
+		case auditHeaderProducer:
+			info.ProducerID = value
+		case auditHeaderHost:
+			info.Host = value
+		case auditHeaderGitSHA:
+			info.GitSHA = value
+		case auditHeaderSchemaVersion:
+			info.SchemaVersion = value
+		case auditHeaderProducedAt:
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			info.ProducedAt = time.Unix(0, ms*int64(time.Millisecond))
+		default:
+			continue
+		}
+
+		found = true
+	}
+
+	return info, found
+}
@@ -0,0 +1,87 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAuditInterceptor tests audit header stamping and parsing, no broker is needed.
+func TestAuditInterceptor(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	ai, err := NewAuditInterceptor(AuditConfig{
+		ProducerID: "orders-service",
+		GitSHA:     "abc123",
+		SchemaVersion: func(msg *Message) string {
+			return "7"
+		},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	p.AddProduceInterceptor(ai)
+
+	topic := "gotest"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0},
+		Headers: []Header{
+			{Key: "app", Value: []byte("x")},
+			{Key: "audit.producer", Value: []byte("upstream-service")},
+		}}
+
+	before := time.Now().Add(-time.Millisecond)
+	err = p.Produce(msg, nil)
+	if err != nil {
+		t.Fatalf("Produce failed: %s", err)
+	}
+
+	info, found := ParseAuditHeaders(msg, "")
+	if !found {
+		t.Fatalf("Expected audit headers in %v", msg.Headers)
+	}
+
+	if info.ProducerID != "orders-service" || info.GitSHA != "abc123" ||
+		info.SchemaVersion != "7" || info.Host == "" {
+		t.Errorf("Unexpected audit info %v", info)
+	}
+
+	if info.ProducedAt.Before(before) || info.ProducedAt.After(time.Now()) {
+		t.Errorf("Unexpected produce time %v", info.ProducedAt)
+	}
+
+	producerHeaders := 0
+	for _, hdr := range msg.Headers {
+		if hdr.Key == "audit.producer" {
+			producerHeaders++
+		}
+	}
+	if producerHeaders != 1 || msg.Headers[0].Key != "app" {
+		t.Errorf("Expected existing audit headers to be replaced: %v", msg.Headers)
+	}
+
+	_, found = ParseAuditHeaders(&Message{}, "")
+	if found {
+		t.Errorf("Expected no audit headers in empty message")
+	}
+}
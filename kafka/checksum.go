@@ -0,0 +1,118 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// ChecksumHeader is the header holding the end-to-end checksum of
+// a message, see NewChecksumInterceptor().
+const ChecksumHeader = "checksum.crc32c"
+
+// checksumTable is the CRC-32C (Castagnoli) table
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumOf returns the CRC-32C checksum of msg's key and value,
+// formatted as 8 hex digits.
+func checksumOf(msg *Message) string {
+	// The key length separates the key from the value
+	var keyLen [4]byte
+	binary.BigEndian.PutUint32(keyLen[:], uint32(len(msg.Key)))
+
+	crc := crc32.Update(0, checksumTable, keyLen[:])
+	crc = crc32.Update(crc, checksumTable, msg.Key)
+	crc = crc32.Update(crc, checksumTable, msg.Value)
+
+	return fmt.Sprintf("%08x", crc)
+}
+
+// checksumInterceptor adds checksum headers
+type checksumInterceptor struct{}
+
+// NewChecksumInterceptor returns a ProduceInterceptor adding an end-to-end
+// checksum of each produced message's serialized key and value in the
+// ChecksumHeader header, detecting corruption introduced between the
+// producer and the consumer, e.g., by intermediate processors or proxies.
+// See Producer.AddProduceInterceptor() and VerifyChecksum()
+//
+// Add it after any interceptors modifying the key or value,
+// such as NewKeyGeneratorInterceptor(), for the checksum to cover them.
+//
+// An existing checksum header, e.g., of a forwarded message, is replaced.
+func NewChecksumInterceptor() ProduceInterceptor {
+	return checksumInterceptor{}
+}
+
+// OnProduce implements ProduceInterceptor by replacing the checksum
+// header of msg.
+func (ci checksumInterceptor) OnProduce(msg *Message) error {
+	var headers []Header
+	for _, hdr := range msg.Headers {
+		if hdr.Key != ChecksumHeader {
+			headers = append(headers, hdr)
+		}
+	}
+	msg.Headers = append(headers,
+		Header{Key: ChecksumHeader, Value: []byte(checksumOf(msg))})
+
+	return nil
+}
+
+// VerifyChecksum verifies the checksum of msg, as added by the
+// interceptor returned by NewChecksumInterceptor().
+// Returns nil if the checksum matches, an ErrBadMsg error if it does not,
+// or an ErrNoent error if msg has no checksum header.
+func VerifyChecksum(msg *Message) error {
+	for _, hdr := range msg.Headers {
+		if hdr.Key != ChecksumHeader {
+			continue
+		}
+
+		expected := string(hdr.Value)
+		actual := checksumOf(msg)
+		if actual != expected {
+			return newErrorFromString(ErrBadMsg,
+				fmt.Sprintf("Checksum mismatch for message %v: expected %s, got %s",
+					msg, expected, actual))
+		}
+		return nil
+	}
+
+	return newErrorFromString(ErrNoent,
+		fmt.Sprintf("No %s header in message %v", ChecksumHeader, msg))
+}
+
+// ChecksumVerifyingHandler returns a MessageHandler that verifies each
+// message's checksum before passing it to handler, returning the
+// verification error instead of calling handler if the checksum does not
+// match.
+// Messages without a checksum header are passed to handler unless
+// required is true.
+func ChecksumVerifyingHandler(handler MessageHandler, required bool) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		err := VerifyChecksum(msg)
+		if err != nil && (required || err.(Error).Code() != ErrNoent) {
+			return err
+		}
+
+		return handler(ctx, msg)
+	}
+}
@@ -0,0 +1,92 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+)
+
+// TestChecksum tests adding and verifying message checksums,
+// no broker is needed.
+func TestChecksum(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	p.AddProduceInterceptor(NewChecksumInterceptor())
+
+	topic := "gotest"
+	msg := &Message{
+		TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny},
+		Key:            []byte("key"),
+		Value:          []byte("value"),
+		Headers: []Header{
+			{Key: "app", Value: []byte("kept")},
+			{Key: ChecksumHeader, Value: []byte("stale")},
+		},
+	}
+
+	err = p.Produce(msg, nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(msg.Headers) != 2 || msg.Headers[0].Key != "app" {
+		t.Fatalf("Expected app and checksum headers, got %v", msg.Headers)
+	}
+
+	err = VerifyChecksum(msg)
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+
+	// Moving a byte from the key to the value must be detected
+	msg.Key, msg.Value = []byte("ke"), []byte("yvalue")
+	err = VerifyChecksum(msg)
+	if err == nil || err.(Error).Code() != ErrBadMsg {
+		t.Errorf("Expected ErrBadMsg, got %v", err)
+	}
+
+	handled := 0
+	handler := func(ctx context.Context, msg *Message) error {
+		handled++
+		return nil
+	}
+
+	if ChecksumVerifyingHandler(handler, false)(context.Background(), msg) == nil {
+		t.Errorf("Expected corrupt message to be rejected")
+	}
+
+	plain := &Message{Value: []byte("value")}
+	err = ChecksumVerifyingHandler(handler, false)(context.Background(), plain)
+	if err != nil {
+		t.Errorf("Expected message without checksum to be handled: %s", err)
+	}
+	err = ChecksumVerifyingHandler(handler, true)(context.Background(), plain)
+	if err == nil || err.(Error).Code() != ErrNoent {
+		t.Errorf("Expected ErrNoent for required checksum, got %v", err)
+	}
+
+	if handled != 1 {
+		t.Errorf("Expected 1 handled message, got %d", handled)
+	}
+}
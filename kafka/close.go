@@ -0,0 +1,44 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+)
+
+// CloseReport summarizes the outcome of closing a Producer or Consumer
+// with CloseContext().
+type CloseReport struct {
+	// MessagesFlushed is the number of outstanding messages and requests
+	// that completed delivery (successfully or not) while closing (Producer).
+	MessagesFlushed int
+	// MessagesDropped is the number of messages and requests still
+	// outstanding when the close context was done, which were
+	// dropped by closing (Producer).
+	MessagesDropped int
+	// OffsetsCommitted are the offsets committed while closing (Consumer).
+	OffsetsCommitted []TopicPartition
+	// PartitionsRevoked is the partition assignment given up by
+	// closing (Consumer).
+	PartitionsRevoked []TopicPartition
+}
+
+// String returns a human-readable representation of a CloseReport.
+func (r CloseReport) String() string {
+	return fmt.Sprintf("CloseReport(flushed %d, dropped %d, committed %v, revoked %v)",
+		r.MessagesFlushed, r.MessagesDropped, r.OffsetsCommitted, r.PartitionsRevoked)
+}
@@ -17,8 +17,10 @@ package kafka
  */
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -47,6 +49,10 @@ type Consumer struct {
 	rebalanceCb        RebalanceCb
 	appReassigned      bool
 	appRebalanceEnable bool // config setting
+	autoCommit         bool // config setting
+	isClosed           int32
+	// processing of consumed messages (managed commit mode), or nil
+	processed *processedTracker
 }
 
 // Strings returns a human readable name for a Consumer instance
@@ -190,6 +196,7 @@ func (c *Consumer) CommitMessage(m *Message) ([]TopicPartition, error) {
 }
 
 // CommitOffsets commits the provided list of offsets
+// along with their optional Metadata.
 // This is a blocking call.
 // Returns the committed offsets on success.
 func (c *Consumer) CommitOffsets(offsets []TopicPartition) ([]TopicPartition, error) {
@@ -323,8 +330,20 @@ func (c *Consumer) ReadMessage(timeout time.Duration) (*Message, error) {
 
 // Close Consumer instance.
 // The object is no longer usable after this call.
+// Close is safe to call multiple times and from multiple goroutines,
+// only the first call, or a CloseContext() call, closes the instance
+// while subsequent calls return an ErrState error.
 func (c *Consumer) Close() (err error) {
+	if !atomic.CompareAndSwapInt32(&c.isClosed, 0, 1) {
+		return newErrorFromString(ErrState, "Consumer already closed")
+	}
+
+	return c.close()
+}
 
+// close closes the Consumer instance, once claimed by Close() or
+// CloseContext()
+func (c *Consumer) close() error {
 	if c.eventsChanEnable {
 		// Wait for consumerReader() to terminate (by closing readerTermChan)
 		close(c.readerTermChan)
@@ -347,6 +366,46 @@ func (c *Consumer) Close() (err error) {
 	return nil
 }
 
+// CloseContext commits the stored offsets of the current assignment,
+// unless `enable.auto.commit` is disabled or ctx is already done,
+// and then closes the Consumer instance.
+//
+// The returned CloseReport provides the committed offsets and the
+// partitions that were revoked by leaving the consumer group.
+// An offset commit failure is returned as err, but does not prevent
+// the Consumer from being closed.
+//
+// The instance is considered closed as soon as CloseContext is called:
+// concurrent Close() and CloseContext() calls return an ErrState error.
+// See Close()
+func (c *Consumer) CloseContext(ctx context.Context) (report CloseReport, err error) {
+	if !atomic.CompareAndSwapInt32(&c.isClosed, 0, 1) {
+		return report, newErrorFromString(ErrState, "Consumer already closed")
+	}
+
+	report.PartitionsRevoked, _ = c.Assignment()
+
+	if c.autoCommit && len(report.PartitionsRevoked) > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		default:
+			report.OffsetsCommitted, err = c.Commit()
+			if kerr, ok := err.(Error); ok && kerr.Code() == ErrNoOffset {
+				// Nothing to commit
+				err = nil
+			}
+		}
+	}
+
+	closeErr := c.close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return report, err
+}
+
 // NewConsumer creates a new high-level Consumer instance.
 //
 // Supported special configuration properties:
@@ -356,6 +415,7 @@ func (c *Consumer) Close() (err error) {
 //                                        respectively.
 //   go.events.channel.enable (bool, false) - Enable the Events() channel. Messages and events will be pushed on the Events() channel and the Poll() interface will be disabled. (Experimental)
 //   go.events.channel.size (int, 1000) - Events() channel size
+//   go.managed.commit.enable (bool, false) - Enable the managed commit mode: offsets are only stored, and thus committed, once the application has marked the consumed messages up to them as processed with MarkProcessed(). Implies enable.auto.offset.store=false.
 //
 // WARNING: Due to the buffering nature of channels (and queues in general) the
 // use of the events channel risks receiving outdated events and
@@ -390,6 +450,24 @@ func NewConsumer(conf *ConfigMap) (*Consumer, error) {
 	}
 	c.appRebalanceEnable = v.(bool)
 
+	// Track auto commit, without extracting it, for CloseContext()
+	v, _ = confCopy.get("enable.auto.commit", nil)
+	switch v {
+	case false, "false", "0", 0:
+		c.autoCommit = false
+	default:
+		c.autoCommit = true
+	}
+
+	v, err = confCopy.extract("go.managed.commit.enable", false)
+	if err != nil {
+		return nil, err
+	}
+	if v.(bool) {
+		c.processed = newProcessedTracker()
+		confCopy.SetKey("enable.auto.offset.store", false)
+	}
+
 	v, err = confCopy.extract("go.events.channel.enable", false)
 	if err != nil {
 		return nil, err
@@ -549,7 +627,8 @@ func (c *Consumer) Assignment() (partitions []TopicPartition, err error) {
 	return partitions, nil
 }
 
-// Committed retrieves committed offsets for the given set of partitions
+// Committed retrieves committed offsets, and their Metadata,
+// for the given set of partitions
 func (c *Consumer) Committed(partitions []TopicPartition, timeoutMs int) (offsets []TopicPartition, err error) {
 	cparts := newCPartsFromTopicPartitions(partitions)
 	defer C.rd_kafka_topic_partition_list_destroy(cparts)
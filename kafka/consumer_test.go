@@ -17,6 +17,7 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
@@ -78,6 +79,11 @@ func TestConsumerAPIs(t *testing.T) {
 			t.Errorf("StoreOffsets() TopicPartition error: %s", toppar.Error)
 		}
 	}
+	metadata := "sink watermark 1234"
+	stored, _ = c.StoreOffsets([]TopicPartition{{Topic: &topic, Partition: 0, Offset: 1, Metadata: &metadata}})
+	if len(stored) != 1 || stored[0].Metadata == nil || *stored[0].Metadata != metadata {
+		t.Errorf("StoreOffsets() did not retain offset metadata: %v", stored)
+	}
 	var empty []TopicPartition
 	stored, err = c.StoreOffsets(empty)
 	if err != nil {
@@ -245,3 +251,31 @@ func TestConsumerAssignment(t *testing.T) {
 	}
 	c.Close()
 }
+
+// TestConsumerCloseContext verifies CloseContext() reporting and repeated Close() calls.
+func TestConsumerCloseContext(t *testing.T) {
+	c, err := NewConsumer(&ConfigMap{
+		"group.id":          "gotest",
+		"socket.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	partitions := []TopicPartition{{Topic: &topic, Partition: 0}, {Topic: &topic, Partition: 1}}
+	err = c.Assign(partitions)
+	if err != nil {
+		t.Fatalf("Assign failed: %s", err)
+	}
+
+	report, err := c.CloseContext(context.Background())
+	t.Logf("CloseContext() returned %v and error %v", report, err)
+	if len(report.PartitionsRevoked) != len(partitions) {
+		t.Errorf("Expected %d revoked partitions, not %v", len(partitions), report.PartitionsRevoked)
+	}
+
+	err = c.Close()
+	if err == nil || err.(Error).Code() != ErrState {
+		t.Errorf("Expected ErrState from Close() on closed consumer, not %v", err)
+	}
+}
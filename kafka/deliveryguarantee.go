@@ -0,0 +1,165 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// DeliveryGuarantee is a producer delivery guarantee preset,
+// see DeliveryGuarantee.Apply() and NewProducerWithGuarantee().
+type DeliveryGuarantee int
+
+const (
+	// AtMostOnce - messages are never retried and thus never duplicated,
+	// but may be lost on transient errors.
+	// Sets `acks=1` and `message.send.max.retries=0`.
+	AtMostOnce = DeliveryGuarantee(iota)
+	// AtLeastOnce - messages are acknowledged by all in-sync replicas and
+	// retried until `message.timeout.ms`, they may be duplicated and,
+	// with `max.in.flight.requests.per.connection` > 1, reordered by retries.
+	// Sets `acks=all` and `message.send.max.retries=10000000`.
+	AtLeastOnce
+	// ExactlyOnce - messages are written exactly once and in order per
+	// partition by the idempotent producer, for the lifetime of the Producer
+	// instance.
+	// Sets `enable.idempotence=true` and `acks=all`.
+	//
+	// NOTE: Transactions, and thus exactly once semantics spanning multiple
+	// partitions or Producer instances, are not supported.
+	ExactlyOnce
+)
+
+// String returns the human-readable representation of a DeliveryGuarantee
+func (g DeliveryGuarantee) String() string {
+	switch g {
+	case AtMostOnce:
+		return "AtMostOnce"
+	case AtLeastOnce:
+		return "AtLeastOnce"
+	case ExactlyOnce:
+		return "ExactlyOnce"
+	default:
+		return fmt.Sprintf("Unknown%d?", int(g))
+	}
+}
+
+// guaranteeSetting is a configuration property set by a DeliveryGuarantee
+type guaranteeSetting struct {
+	// property name followed by its aliases
+	names []string
+	// value set if the property is not configured
+	value ConfigValue
+	// valid returns true if a configured value is compatible
+	// with the guarantee.
+	valid func(v string) bool
+}
+
+// Property names and aliases
+var (
+	acksNames       = []string{"acks", "request.required.acks", "{topic}.acks", "{topic}.request.required.acks"}
+	retriesNames    = []string{"message.send.max.retries", "retries"}
+	idempotentNames = []string{"enable.idempotence"}
+	inFlightNames   = []string{"max.in.flight.requests.per.connection", "max.in.flight"}
+)
+
+func isAcksAll(v string) bool {
+	return v == "all" || v == "-1"
+}
+
+// settings returns the configuration properties set by g
+func (g DeliveryGuarantee) settings() []guaranteeSetting {
+	switch g {
+	case AtMostOnce:
+		return []guaranteeSetting{
+			{acksNames, "1", func(v string) bool { return !isAcksAll(v) }},
+			{retriesNames, 0, func(v string) bool { return v == "0" }},
+			{idempotentNames, false, func(v string) bool { return v == "false" }},
+		}
+	case AtLeastOnce:
+		return []guaranteeSetting{
+			{acksNames, "all", isAcksAll},
+			{retriesNames, 10000000, func(v string) bool { return v != "0" }},
+		}
+	case ExactlyOnce:
+		return []guaranteeSetting{
+			{idempotentNames, true, func(v string) bool { return v == "true" }},
+			{acksNames, "all", isAcksAll},
+			{retriesNames, nil, func(v string) bool { return v != "0" }},
+			{inFlightNames, nil, func(v string) bool {
+				n, err := strconv.Atoi(v)
+				return err == nil && n <= 5
+			}},
+		}
+	default:
+		return nil
+	}
+}
+
+// Apply returns a copy of conf with the producer configuration properties
+// required by the delivery guarantee g set.
+//
+// Properties already configured in conf are retained, but an ErrInvalidArg
+// error is returned if any of them is incompatible with g.
+func (g DeliveryGuarantee) Apply(conf *ConfigMap) (*ConfigMap, error) {
+	settings := g.settings()
+	if settings == nil {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid DeliveryGuarantee %v", g))
+	}
+
+	confCopy := conf.clone()
+
+	for _, setting := range settings {
+		configured := false
+
+		for _, name := range setting.names {
+			v, _ := confCopy.get(name, nil)
+			if v == nil {
+				continue
+			}
+
+			configured = true
+
+			value, errstr := value2string(v)
+			if errstr != "" || !setting.valid(value) {
+				return nil, newErrorFromString(ErrInvalidArg,
+					fmt.Sprintf("%s=%v is incompatible with the %v delivery guarantee",
+						name, v, g))
+			}
+		}
+
+		if !configured && setting.value != nil {
+			confCopy.SetKey(setting.names[0], setting.value)
+		}
+	}
+
+	return &confCopy, nil
+}
+
+// NewProducerWithGuarantee creates a new Producer configured for the
+// delivery guarantee g.
+// See DeliveryGuarantee.Apply() and NewProducer()
+func NewProducerWithGuarantee(conf *ConfigMap, g DeliveryGuarantee) (*Producer, error) {
+	guaranteedConf, err := g.Apply(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewProducer(guaranteedConf)
+}
@@ -0,0 +1,84 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+)
+
+// TestDeliveryGuaranteeApply tests the configuration set and
+// validated by each delivery guarantee preset
+func TestDeliveryGuaranteeApply(t *testing.T) {
+	expected := map[DeliveryGuarantee]ConfigMap{
+		AtMostOnce: {"acks": "1", "message.send.max.retries": 0,
+			"enable.idempotence": false},
+		AtLeastOnce: {"acks": "all", "message.send.max.retries": 10000000},
+		ExactlyOnce: {"acks": "all", "enable.idempotence": true},
+	}
+
+	for g, expConf := range expected {
+		conf := &ConfigMap{"bootstrap.servers": "localhost"}
+
+		guaranteedConf, err := g.Apply(conf)
+		if err != nil {
+			t.Fatalf("%v: %s", g, err)
+		}
+
+		if len(*conf) != 1 {
+			t.Errorf("%v: original config modified: %v", g, conf)
+		}
+
+		if len(*guaranteedConf) != len(expConf)+1 {
+			t.Errorf("%v: expected %v, got %v", g, expConf, guaranteedConf)
+		}
+
+		for k, v := range expConf {
+			if (*guaranteedConf)[k] != v {
+				t.Errorf("%v: expected %s=%v, got %v", g, k, v, (*guaranteedConf)[k])
+			}
+		}
+	}
+
+	// Compatible explicit settings are retained
+	guaranteedConf, err := ExactlyOnce.Apply(&ConfigMap{"request.required.acks": -1, "max.in.flight": 5})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, found := (*guaranteedConf)["acks"]; found {
+		t.Errorf("Expected acks alias to be retained, got %v", guaranteedConf)
+	}
+
+	// Incompatible explicit settings
+	for _, tc := range []struct {
+		g    DeliveryGuarantee
+		conf ConfigMap
+	}{
+		{AtMostOnce, ConfigMap{"acks": "all"}},
+		{AtMostOnce, ConfigMap{"retries": 3}},
+		{AtLeastOnce, ConfigMap{"acks": 1}},
+		{AtLeastOnce, ConfigMap{"default.topic.config": ConfigMap{"acks": "0"}}},
+		{ExactlyOnce, ConfigMap{"enable.idempotence": "false"}},
+		{ExactlyOnce, ConfigMap{"max.in.flight.requests.per.connection": 10}},
+		{ExactlyOnce, ConfigMap{"message.send.max.retries": 0}},
+		{DeliveryGuarantee(99), ConfigMap{}},
+	} {
+		_, err := tc.g.Apply(&tc.conf)
+		if err == nil || err.(Error).Code() != ErrInvalidArg {
+			t.Errorf("%v with %v: expected ErrInvalidArg, got %v", tc.g, tc.conf, err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package devcluster provides a local single-broker Apache Kafka cluster,
+// running in a Docker container, for examples, development and tests.
+//
+//	cluster, err := devcluster.Start(ctx, devcluster.Config{
+//	    Topics: []kafka.TopicSpecification{{Topic: "orders", NumPartitions: 3}},
+//	})
+//	if err != nil {
+//	    // ...
+//	}
+//	defer cluster.Stop()
+//
+//	p, err := kafka.NewProducer(cluster.ProducerConfig())
+//
+// The broker runs in KRaft mode, without ZooKeeper.
+// Set the KAFKA_BOOTSTRAP_SERVERS environment variable to use an existing
+// cluster instead of starting a container.
+package devcluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// DefaultImage is the default broker container image
+const DefaultImage = "apache/kafka:3.7.0"
+
+// BootstrapServersEnv is the environment variable that, if set, provides
+// the bootstrap servers of an existing cluster to use instead of
+// starting a container.
+const BootstrapServersEnv = "KAFKA_BOOTSTRAP_SERVERS"
+
+// dockerCommand is the docker executable, replaced by tests.
+var dockerCommand = "docker"
+
+// Config configures a development cluster.
+type Config struct {
+	// Image is the broker container image, defaults to DefaultImage.
+	Image string
+	// Port is the host port the broker listens on, defaults to 9092.
+	Port int
+	// Topics are created, if they do not already exist, once the
+	// cluster is ready. NumPartitions and ReplicationFactor default to 1.
+	Topics []kafka.TopicSpecification
+	// StartTimeout is the maximum time to wait for the cluster to become
+	// ready, defaults to 60 seconds.
+	StartTimeout time.Duration
+}
+
+// Cluster is a running development cluster.
+type Cluster struct {
+	// BootstrapServers of the cluster.
+	BootstrapServers string
+
+	containerID string
+}
+
+// dockerRunArgs returns the docker arguments that start a single-broker
+// KRaft cluster for config.
+func dockerRunArgs(config Config) []string {
+	env := []string{
+		"KAFKA_NODE_ID=1",
+		"KAFKA_PROCESS_ROLES=broker,controller",
+		"KAFKA_LISTENERS=PLAINTEXT://:9092,CONTROLLER://:9093",
+		fmt.Sprintf("KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://localhost:%d", config.Port),
+		"KAFKA_CONTROLLER_LISTENER_NAMES=CONTROLLER",
+		"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP=CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+		"KAFKA_CONTROLLER_QUORUM_VOTERS=1@localhost:9093",
+		"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1",
+		"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR=1",
+		"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR=1",
+		"KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS=0",
+	}
+
+	args := []string{"run", "--detach", "--rm",
+		"--publish", fmt.Sprintf("%d:9092", config.Port)}
+	for _, e := range env {
+		args = append(args, "--env", e)
+	}
+
+	return append(args, config.Image)
+}
+
+// docker runs docker with args, returning its trimmed standard output.
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, dockerCommand, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("docker %s failed: %s: %s",
+			args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Start starts a development cluster, waits for it to become ready and
+// creates config.Topics.
+//
+// If the KAFKA_BOOTSTRAP_SERVERS environment variable is set that
+// cluster is used instead, and only topics are created.
+//
+// Docker must be installed and running unless an existing cluster is used.
+func Start(ctx context.Context, config Config) (*Cluster, error) {
+	if config.Image == "" {
+		config.Image = DefaultImage
+	}
+	if config.Port == 0 {
+		config.Port = 9092
+	}
+	if config.StartTimeout == 0 {
+		config.StartTimeout = 60 * time.Second
+	}
+
+	c := &Cluster{BootstrapServers: os.Getenv(BootstrapServersEnv)}
+
+	if c.BootstrapServers == "" {
+		if _, err := exec.LookPath(dockerCommand); err != nil {
+			return nil, fmt.Errorf("Docker is not available (%s), "+
+				"install Docker or set %s to use an existing cluster",
+				err, BootstrapServersEnv)
+		}
+
+		id, err := docker(ctx, dockerRunArgs(config)...)
+		if err != nil {
+			return nil, err
+		}
+
+		c.containerID = id
+		c.BootstrapServers = fmt.Sprintf("localhost:%d", config.Port)
+	}
+
+	err := c.awaitReady(ctx, config.StartTimeout)
+	if err == nil {
+		err = c.CreateTopics(ctx, config.Topics...)
+	}
+	if err != nil {
+		c.Stop()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// awaitReady waits up to timeout for the cluster to serve metadata
+func (c *Cluster) awaitReady(ctx context.Context, timeout time.Duration) error {
+	a, err := kafka.NewAdminClient(c.config())
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		md, err := a.GetMetadata(nil, false, 1000)
+		if err == nil && len(md.Brokers) > 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Cluster %s not ready within %v: %v",
+				c.BootstrapServers, timeout, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// CreateTopics creates topics on the cluster, topics that already exist
+// are left unmodified.
+// NumPartitions and ReplicationFactor default to 1.
+func (c *Cluster) CreateTopics(ctx context.Context, topics ...kafka.TopicSpecification) error {
+	if len(topics) == 0 {
+		return nil
+	}
+
+	specs := make([]kafka.TopicSpecification, len(topics))
+	for i, spec := range topics {
+		if spec.NumPartitions == 0 {
+			spec.NumPartitions = 1
+		}
+		if spec.ReplicationFactor == 0 && spec.ReplicaAssignment == nil {
+			spec.ReplicationFactor = 1
+		}
+		specs[i] = spec
+	}
+
+	a, err := kafka.NewAdminClient(c.config())
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	results, err := a.CreateTopics(ctx, specs)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError &&
+			result.Error.Code() != kafka.ErrTopicAlreadyExists {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+// config returns the base client configuration of the cluster
+func (c *Cluster) config() *kafka.ConfigMap {
+	return &kafka.ConfigMap{"bootstrap.servers": c.BootstrapServers}
+}
+
+// ProducerConfig returns a ready-to-use producer configuration
+// for the cluster.
+func (c *Cluster) ProducerConfig() *kafka.ConfigMap {
+	return c.config()
+}
+
+// ConsumerConfig returns a ready-to-use consumer configuration
+// for the cluster, consuming as group groupID from the earliest offset.
+func (c *Cluster) ConsumerConfig(groupID string) *kafka.ConfigMap {
+	conf := c.config()
+	conf.SetKey("group.id", groupID)
+	conf.SetKey("auto.offset.reset", "earliest")
+	return conf
+}
+
+// Stop stops and removes the cluster's container, if it was started
+// by Start(). An existing cluster is left running.
+func (c *Cluster) Stop() error {
+	if c.containerID == "" {
+		return nil
+	}
+
+	_, err := docker(context.Background(), "rm", "--force", c.containerID)
+	if err != nil {
+		return err
+	}
+
+	c.containerID = ""
+	return nil
+}
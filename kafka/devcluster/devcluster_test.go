@@ -0,0 +1,60 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package devcluster
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestDockerRunArgs tests the container arguments, no Docker is needed.
+func TestDockerRunArgs(t *testing.T) {
+	args := dockerRunArgs(Config{Image: "img", Port: 19092})
+
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{
+		"--publish 19092:9092",
+		"--env KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://localhost:19092",
+		"--env KAFKA_PROCESS_ROLES=broker,controller",
+	} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("Expected %q in %s", expected, joined)
+		}
+	}
+
+	if args[0] != "run" || args[len(args)-1] != "img" {
+		t.Errorf("Unexpected docker arguments %v", args)
+	}
+}
+
+// TestStartWithoutDocker tests that Start fails when Docker is not
+// available and no existing cluster is configured.
+func TestStartWithoutDocker(t *testing.T) {
+	if os.Getenv(BootstrapServersEnv) != "" {
+		t.Skipf("%s is set", BootstrapServersEnv)
+	}
+
+	dockerCommand = "devcluster-test-no-such-docker"
+	defer func() { dockerCommand = "docker" }()
+
+	_, err := Start(context.Background(), Config{})
+	if err == nil || !strings.Contains(err.Error(), "Docker is not available") {
+		t.Errorf("Expected Docker unavailable error, not %v", err)
+	}
+}
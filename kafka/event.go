@@ -165,7 +165,11 @@ out:
 		case C.RD_KAFKA_EVENT_FETCH:
 			// Consumer fetch event, new message.
 			// Extracted into temporary fcMsg for optimization
-			retval = h.newMessageFromFcMsg(&fcMsg)
+			msg := h.newMessageFromFcMsg(&fcMsg)
+			if h.c != nil && h.c.processed != nil {
+				h.c.processed.consumed(msg)
+			}
+			retval = msg
 
 		case C.RD_KAFKA_EVENT_REBALANCE:
 			// Consumer rebalance event
@@ -216,6 +220,8 @@ out:
 				}
 			}
 
+			h.c.rebalanced()
+
 		case C.RD_KAFKA_EVENT_ERROR:
 			// Error event
 			cErr := C.rd_kafka_event_error(rkev)
@@ -255,8 +261,8 @@ out:
 			// Producer Delivery Report event
 			// Each such event contains delivery reports for all
 			// messages in the produced batch.
-			// Forward delivery reports to per-message's response channel
-			// or to the global Producer.Events channel, or none.
+			// Forward delivery reports to per-message's callback or response
+			// channel or to the global Producer.Events channel, or none.
 			rkmessages := make([]*C.rd_kafka_message_t, int(C.rd_kafka_event_message_count(rkev)))
 
 			cnt := int(C.rd_kafka_event_message_array(rkev, (**C.rd_kafka_message_t)(unsafe.Pointer(&rkmessages[0])), C.size_t(len(rkmessages))))
@@ -275,6 +281,15 @@ out:
 							ch = &cdr.deliveryChan
 						}
 						msg.Opaque = cdr.opaque
+
+						if cdr.trace != nil {
+							cdr.trace.delivered(msg)
+						}
+
+						if cdr.deliveryCb != nil {
+							cdr.deliveryCb(msg)
+							continue
+						}
 					}
 				}
 
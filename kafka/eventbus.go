@@ -0,0 +1,191 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"sync"
+)
+
+// EventBus dispatches client events to typed handlers, as an alternative
+// to type-switching on events read from the Events() channel or Poll().
+//
+// Handlers are registered with the On*() methods and invoked, in
+// registration order, from the goroutine calling Publish() or Run().
+// Events without a matching typed handler are passed to the
+// OnUnhandled() handlers, if any.
+//
+// Note that *Message events are fetched messages for a Consumer and
+// delivery reports for a Producer.
+//
+// EventBus is safe for concurrent use.
+type EventBus struct {
+	lock                 sync.RWMutex
+	messageHandlers      []func(*Message)
+	errorHandlers        []func(Error)
+	statsHandlers        []func(*Stats)
+	assignedHandlers     []func(AssignedPartitions)
+	revokedHandlers      []func(RevokedPartitions)
+	partitionEOFHandlers []func(PartitionEOF)
+	committedHandlers    []func(OffsetsCommitted)
+	unhandledHandlers    []func(Event)
+}
+
+// NewEventBus creates a new EventBus without any handlers.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// OnMessage registers a handler for fetched messages (Consumer)
+// and delivery reports (Producer).
+func (b *EventBus) OnMessage(handler func(*Message)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.messageHandlers = append(b.messageHandlers, handler)
+}
+
+// OnError registers a handler for client and broker errors.
+func (b *EventBus) OnError(handler func(Error)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.errorHandlers = append(b.errorHandlers, handler)
+}
+
+// OnStats registers a handler for statistics events.
+// Requires `statistics.interval.ms` to be set.
+func (b *EventBus) OnStats(handler func(*Stats)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.statsHandlers = append(b.statsHandlers, handler)
+}
+
+// OnAssignedPartitions registers a handler for consumer group
+// partition assignment events.
+// Requires `go.application.rebalance.enable`.
+func (b *EventBus) OnAssignedPartitions(handler func(AssignedPartitions)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.assignedHandlers = append(b.assignedHandlers, handler)
+}
+
+// OnRevokedPartitions registers a handler for consumer group
+// partition revocation events.
+// Requires `go.application.rebalance.enable`.
+func (b *EventBus) OnRevokedPartitions(handler func(RevokedPartitions)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.revokedHandlers = append(b.revokedHandlers, handler)
+}
+
+// OnPartitionEOF registers a handler for end of partition events.
+// Requires `enable.partition.eof`.
+func (b *EventBus) OnPartitionEOF(handler func(PartitionEOF)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.partitionEOFHandlers = append(b.partitionEOFHandlers, handler)
+}
+
+// OnOffsetsCommitted registers a handler for offset commit results.
+func (b *EventBus) OnOffsetsCommitted(handler func(OffsetsCommitted)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.committedHandlers = append(b.committedHandlers, handler)
+}
+
+// OnUnhandled registers a handler for events that no typed handler
+// was registered for.
+func (b *EventBus) OnUnhandled(handler func(Event)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.unhandledHandlers = append(b.unhandledHandlers, handler)
+}
+
+// Publish dispatches ev to its registered handlers.
+// Returns true if ev was handled by at least one typed or unhandled handler.
+//
+// Handlers are invoked without holding the EventBus lock, and may
+// register further handlers, which receive subsequent events.
+func (b *EventBus) Publish(ev Event) bool {
+	if ev == nil {
+		return false
+	}
+
+	// Collect the handler invocations under the lock
+	var calls []func()
+
+	b.lock.RLock()
+
+	switch e := ev.(type) {
+	case *Message:
+		for _, h := range b.messageHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	case Error:
+		for _, h := range b.errorHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	case *Stats:
+		for _, h := range b.statsHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	case AssignedPartitions:
+		for _, h := range b.assignedHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	case RevokedPartitions:
+		for _, h := range b.revokedHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	case PartitionEOF:
+		for _, h := range b.partitionEOFHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	case OffsetsCommitted:
+		for _, h := range b.committedHandlers {
+			h := h
+			calls = append(calls, func() { h(e) })
+		}
+	}
+
+	if len(calls) == 0 {
+		for _, h := range b.unhandledHandlers {
+			h := h
+			calls = append(calls, func() { h(ev) })
+		}
+	}
+
+	b.lock.RUnlock()
+
+	for _, call := range calls {
+		call()
+	}
+
+	return len(calls) > 0
+}
+
+// Run dispatches all events read from events, such as a Producer's
+// or Consumer's Events() channel, until the channel is closed.
+func (b *EventBus) Run(events chan Event) {
+	for ev := range events {
+		b.Publish(ev)
+	}
+}
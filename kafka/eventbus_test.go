@@ -0,0 +1,85 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEventBus tests typed event dispatching
+func TestEventBus(t *testing.T) {
+	b := NewEventBus()
+
+	var msgCnt, errCnt, assignedCnt, unhandledCnt int
+	b.OnMessage(func(m *Message) { msgCnt++ })
+	b.OnMessage(func(m *Message) { msgCnt++ })
+	b.OnError(func(e Error) { errCnt++ })
+	b.OnAssignedPartitions(func(e AssignedPartitions) { assignedCnt++ })
+	b.OnUnhandled(func(e Event) { unhandledCnt++ })
+
+	events := make(chan Event, 10)
+	events <- &Message{}
+	events <- newErrorFromString(ErrAllBrokersDown, "down")
+	events <- AssignedPartitions{}
+	events <- RevokedPartitions{}
+	events <- &Stats{"{}"}
+	close(events)
+
+	b.Run(events)
+
+	if msgCnt != 2 || errCnt != 1 || assignedCnt != 1 || unhandledCnt != 2 {
+		t.Errorf("Unexpected dispatch counts: messages %d, errors %d, assigned %d, unhandled %d",
+			msgCnt, errCnt, assignedCnt, unhandledCnt)
+	}
+
+	if b.Publish(nil) {
+		t.Errorf("Expected nil event not to be handled")
+	}
+
+	if NewEventBus().Publish(PartitionEOF{}) {
+		t.Errorf("Expected event not to be handled without handlers")
+	}
+}
+
+// TestEventBusReentrant tests that handlers may register handlers,
+// no broker is needed.
+func TestEventBusReentrant(t *testing.T) {
+	b := NewEventBus()
+
+	errCnt := 0
+	b.OnMessage(func(m *Message) {
+		b.OnError(func(e Error) { errCnt++ })
+	})
+
+	done := make(chan bool)
+	go func() {
+		b.Publish(&Message{})
+		b.Publish(newErrorFromString(ErrAllBrokersDown, "down"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Publish() deadlocked on handler registration")
+	}
+
+	if errCnt != 1 {
+		t.Errorf("Expected handler registered by a handler to be called once, got %d", errCnt)
+	}
+}
@@ -0,0 +1,259 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// GlobalTable materializes a compacted topic, e.g., configuration or
+// feature flags, as a local key-value view of the latest value of each key,
+// kept up to date in the background.
+//
+// All partitions of the topic are consumed from the beginning, without
+// joining a consumer group, and tombstones (nil values) delete their key.
+//
+// Reads are consistent: each read observes the table after a
+// whole number of updates.
+//
+// GlobalTable is safe for concurrent use.
+type GlobalTable struct {
+	topic    string
+	consumer *Consumer
+	onUpdate func(key []byte, oldValue []byte, newValue []byte)
+
+	lock  sync.RWMutex
+	store KeyValueStore
+
+	termChan chan bool
+	doneChan chan error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewGlobalTable creates a new GlobalTable for topic, stored in store
+// (which defaults to NewMemoryKeyValueStore() if nil).
+//
+// onUpdate, if not nil, is called from the table's background goroutine
+// for each update after the initial load, with a nil newValue for deletes.
+//
+// conf must contain at least `bootstrap.servers`.
+// The table is populated by Start().
+func NewGlobalTable(conf *ConfigMap, topic string, store KeyValueStore, onUpdate func(key []byte, oldValue []byte, newValue []byte)) (*GlobalTable, error) {
+	if store == nil {
+		store = NewMemoryKeyValueStore()
+	}
+
+	confCopy := conf.clone()
+	if v, _ := confCopy.get("group.id", nil); v == nil {
+		// Required by NewConsumer() but unused since all
+		// partitions are assigned manually.
+		confCopy.SetKey("group.id", "go-global-table")
+	}
+	confCopy.SetKey("enable.auto.commit", false)
+	confCopy.SetKey("enable.partition.eof", true)
+	confCopy.SetKey("go.events.channel.enable", false)
+
+	c, err := NewConsumer(&confCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GlobalTable{
+		topic:    topic,
+		consumer: c,
+		onUpdate: onUpdate,
+		store:    store,
+	}, nil
+}
+
+// Start loads the current contents of the topic into the table, returning
+// once the end of all partitions has been reached or ctx is done,
+// and then keeps the table up to date in the background until Close().
+func (gt *GlobalTable) Start(ctx context.Context) error {
+	if gt.termChan != nil {
+		return newErrorFromString(ErrState, "GlobalTable already started")
+	}
+
+	md, err := gt.consumer.GetMetadata(&gt.topic, false, 10*1000)
+	if err != nil {
+		return err
+	}
+
+	tmd, found := md.Topics[gt.topic]
+	if !found || tmd.Error.Code() != ErrNoError || len(tmd.Partitions) == 0 {
+		return newErrorFromString(ErrUnknownTopic,
+			fmt.Sprintf("Topic %s not found", gt.topic))
+	}
+
+	partitions := make([]TopicPartition, len(tmd.Partitions))
+	for i, p := range tmd.Partitions {
+		partitions[i] = TopicPartition{Topic: &gt.topic, Partition: p.ID, Offset: OffsetBeginning}
+	}
+
+	err = gt.consumer.Assign(partitions)
+	if err != nil {
+		return err
+	}
+
+	// Initial load
+	loaded := make(map[int32]bool)
+	for len(loaded) < len(partitions) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		ev := gt.consumer.Poll(100)
+		switch e := ev.(type) {
+		case *Message:
+			if e.TopicPartition.Error != nil {
+				return e.TopicPartition.Error
+			}
+			err = gt.apply(e, false)
+			if err != nil {
+				return err
+			}
+		case PartitionEOF:
+			loaded[e.Partition] = true
+		case Error:
+			if e.IsFatal() {
+				return e
+			}
+		}
+	}
+
+	gt.termChan = make(chan bool)
+	gt.doneChan = make(chan error, 1)
+	go gt.follow()
+
+	return nil
+}
+
+// follow applies updates until termChan is closed, or an error occurs,
+// which is returned by Close().
+func (gt *GlobalTable) follow() {
+	for {
+		select {
+		case <-gt.termChan:
+			gt.doneChan <- nil
+			return
+		default:
+		}
+
+		ev := gt.consumer.Poll(100)
+		var err error
+		switch e := ev.(type) {
+		case *Message:
+			if e.TopicPartition.Error != nil {
+				err = e.TopicPartition.Error
+			} else {
+				err = gt.apply(e, true)
+			}
+		case Error:
+			if e.IsFatal() {
+				err = e
+			}
+		}
+
+		if err != nil {
+			gt.doneChan <- err
+			return
+		}
+	}
+}
+
+// apply applies the update msg to the table
+func (gt *GlobalTable) apply(msg *Message, notify bool) error {
+	gt.lock.Lock()
+
+	oldValue, _, err := gt.store.Get(msg.Key)
+	if err == nil {
+		if msg.Value == nil {
+			err = gt.store.Delete(msg.Key)
+		} else {
+			err = gt.store.Put(msg.Key, msg.Value)
+		}
+	}
+
+	gt.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if notify && gt.onUpdate != nil {
+		gt.onUpdate(msg.Key, oldValue, msg.Value)
+	}
+
+	return nil
+}
+
+// Get returns the current value of key, and whether key was found.
+func (gt *GlobalTable) Get(key []byte) (value []byte, found bool, err error) {
+	gt.lock.RLock()
+	defer gt.lock.RUnlock()
+
+	return gt.store.Get(key)
+}
+
+// Snapshot returns a consistent copy of the table's current contents.
+func (gt *GlobalTable) Snapshot() (map[string][]byte, error) {
+	gt.lock.RLock()
+	defer gt.lock.RUnlock()
+
+	snapshot := make(map[string][]byte)
+	err := gt.store.Range(nil, nil, func(key []byte, value []byte) bool {
+		snapshot[string(key)] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// Close stops updating the table, and closes its Consumer and store.
+// Returns the error that stopped background updates, if any.
+// Close is safe to call multiple times, subsequent calls return the
+// first call's error.
+func (gt *GlobalTable) Close() error {
+	gt.closeOnce.Do(func() {
+		if gt.termChan != nil {
+			select {
+			case gt.closeErr = <-gt.doneChan:
+				// Background updates already stopped by error
+			default:
+				close(gt.termChan)
+				gt.closeErr = <-gt.doneChan
+			}
+		}
+
+		gt.consumer.Close()
+
+		gt.lock.Lock()
+		gt.store.Close()
+		gt.lock.Unlock()
+	})
+
+	return gt.closeErr
+}
@@ -0,0 +1,90 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+)
+
+// TestGlobalTable tests GlobalTable updates and reads, no broker is needed.
+func TestGlobalTable(t *testing.T) {
+	type update struct {
+		key      string
+		oldValue []byte
+		newValue []byte
+	}
+	var updates []update
+
+	gt, err := NewGlobalTable(&ConfigMap{"socket.timeout.ms": 10}, "flags", nil,
+		func(key []byte, oldValue []byte, newValue []byte) {
+			updates = append(updates, update{string(key), oldValue, newValue})
+		})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "flags"
+	msgs := []*Message{
+		{Key: []byte("a"), Value: []byte("on")},
+		{Key: []byte("b"), Value: []byte("off")},
+		{Key: []byte("a"), Value: []byte("off")},
+		{Key: []byte("b"), Value: nil},
+	}
+
+	// Initial load: no update notifications
+	err = gt.apply(msgs[0], false)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for _, msg := range msgs[1:] {
+		msg.TopicPartition.Topic = &topic
+		err = gt.apply(msg, true)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	if len(updates) != 3 ||
+		updates[1].key != "a" || string(updates[1].oldValue) != "on" || string(updates[1].newValue) != "off" ||
+		updates[2].key != "b" || string(updates[2].oldValue) != "off" || updates[2].newValue != nil {
+		t.Errorf("Unexpected updates %v", updates)
+	}
+
+	value, found, err := gt.Get([]byte("a"))
+	if err != nil || !found || string(value) != "off" {
+		t.Errorf("Expected a=off, got %s, %v, %v", value, found, err)
+	}
+
+	snapshot, err := gt.Snapshot()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(snapshot) != 1 || string(snapshot["a"]) != "off" {
+		t.Errorf("Unexpected snapshot %v", snapshot)
+	}
+
+	err = gt.Close()
+	if err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+
+	// Already closed
+	err = gt.Close()
+	if err != nil {
+		t.Errorf("Repeated Close failed: %s", err)
+	}
+}
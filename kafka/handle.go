@@ -168,7 +168,9 @@ type cgoif interface{}
 // delivery report cgoif container
 type cgoDr struct {
 	deliveryChan chan Event
+	deliveryCb   func(*Message)
 	opaque       interface{}
+	trace        *produceTrace
 }
 
 // cgoPut adds object cg to the handle's cgo map and returns a
@@ -154,10 +154,14 @@ import "C"
 const PartitionAny = int32(C.RD_KAFKA_PARTITION_UA)
 
 // TopicPartition is a generic placeholder for a Topic+Partition and optionally Offset.
+//
+// Metadata is an optional application-specific string committed along
+// with the Offset, see Consumer.CommitOffsets() and Consumer.Committed().
 type TopicPartition struct {
 	Topic     *string
 	Partition int32
 	Offset    Offset
+	Metadata  *string
 	Error     error
 }
 
@@ -204,6 +208,13 @@ func newCPartsFromTopicPartitions(partitions []TopicPartition) (cparts *C.rd_kaf
 		defer C.free(unsafe.Pointer(ctopic))
 		rktpar := C.rd_kafka_topic_partition_list_add(cparts, ctopic, C.int32_t(part.Partition))
 		rktpar.offset = C.int64_t(part.Offset)
+
+		if part.Metadata != nil {
+			// Owned, and freed, by the partition list
+			cmetadata := C.CString(*part.Metadata)
+			rktpar.metadata = unsafe.Pointer(cmetadata)
+			rktpar.metadata_size = C.size_t(len(*part.Metadata))
+		}
 	}
 
 	return cparts
@@ -215,6 +226,12 @@ func setupTopicPartitionFromCrktpar(partition *TopicPartition, crktpar *C.rd_kaf
 	partition.Topic = &topic
 	partition.Partition = int32(crktpar.partition)
 	partition.Offset = Offset(crktpar.offset)
+	if crktpar.metadata_size > 0 {
+		size := C.int(crktpar.metadata_size)
+		cstr := (*C.char)(unsafe.Pointer(crktpar.metadata))
+		metadata := C.GoStringN(cstr, size)
+		partition.Metadata = &metadata
+	}
 	if crktpar.err != C.RD_KAFKA_RESP_ERR_NO_ERROR {
 		partition.Error = newError(crktpar.err)
 	}
@@ -0,0 +1,261 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyGenerator generates the key of a message produced without a key
+// (nil Message.Key), see NewKeyGeneratorInterceptor().
+type KeyGenerator interface {
+	// GenerateKey returns the key to use for msg.
+	GenerateKey(msg *Message) ([]byte, error)
+}
+
+// KeyGeneratorFunc adapts an ordinary function to the KeyGenerator interface.
+type KeyGeneratorFunc func(msg *Message) ([]byte, error)
+
+// GenerateKey calls f(msg)
+func (f KeyGeneratorFunc) GenerateKey(msg *Message) ([]byte, error) {
+	return f(msg)
+}
+
+// uuidV7KeyGenerator generates UUID version 7 keys
+type uuidV7KeyGenerator struct{}
+
+// NewUUIDv7KeyGenerator returns a KeyGenerator generating time-ordered
+// UUID version 7 keys in their canonical 36 character string form.
+func NewUUIDv7KeyGenerator() KeyGenerator {
+	return uuidV7KeyGenerator{}
+}
+
+// GenerateKey implements KeyGenerator
+func (g uuidV7KeyGenerator) GenerateKey(msg *Message) ([]byte, error) {
+	var uuid [16]byte
+
+	_, err := rand.Read(uuid[6:])
+	if err != nil {
+		return nil, err
+	}
+
+	// 48-bit big-endian Unix timestamp in milliseconds
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		uuid[i] = byte(ms >> uint(8*(5-i)))
+	}
+
+	uuid[6] = (uuid[6] & 0x0f) | 0x70 // version 7
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	key := make([]byte, 36)
+	hex.Encode(key[0:8], uuid[0:4])
+	key[8] = '-'
+	hex.Encode(key[9:13], uuid[4:6])
+	key[13] = '-'
+	hex.Encode(key[14:18], uuid[6:8])
+	key[18] = '-'
+	hex.Encode(key[19:23], uuid[8:10])
+	key[23] = '-'
+	hex.Encode(key[24:], uuid[10:])
+
+	return key, nil
+}
+
+const (
+	// snowflakeEpochMs is the custom epoch (2010-11-04T01:42:54.657Z)
+	// of the original snowflake id scheme.
+	snowflakeEpochMs  = 1288834974657
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = (1 << snowflakeNodeBits) - 1
+	snowflakeMaxSeq   = (1 << snowflakeSeqBits) - 1
+)
+
+// snowflakeKeyGenerator generates snowflake id keys
+type snowflakeKeyGenerator struct {
+	lock   sync.Mutex
+	nodeID int64
+	lastMs int64
+	seq    int64
+}
+
+// NewSnowflakeKeyGenerator returns a KeyGenerator generating unique,
+// roughly time-ordered, 64-bit snowflake ids (41-bit timestamp, 10-bit node id,
+// 12-bit sequence) as decimal strings.
+//
+// nodeID must be in the range 0..1023 and unique across all concurrently
+// running generators to guarantee uniqueness.
+func NewSnowflakeKeyGenerator(nodeID int) (KeyGenerator, error) {
+	if nodeID < 0 || nodeID > snowflakeMaxNode {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid snowflake node id %d, must be 0..%d", nodeID, snowflakeMaxNode))
+	}
+
+	return &snowflakeKeyGenerator{nodeID: int64(nodeID)}, nil
+}
+
+// nextID returns the next snowflake id
+func (g *snowflakeKeyGenerator) nextID() int64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	nowMs := time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpochMs
+	if nowMs < g.lastMs {
+		// Clock moved backwards: stick to the last timestamp
+		// to keep ids unique.
+		nowMs = g.lastMs
+	}
+
+	if nowMs == g.lastMs {
+		g.seq = (g.seq + 1) & snowflakeMaxSeq
+		if g.seq == 0 {
+			// Sequence exhausted for this millisecond,
+			// wait for the next one.
+			for nowMs <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				nowMs = time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpochMs
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+
+	g.lastMs = nowMs
+
+	return (nowMs << (snowflakeNodeBits + snowflakeSeqBits)) |
+		(g.nodeID << snowflakeSeqBits) | g.seq
+}
+
+// GenerateKey implements KeyGenerator
+func (g *snowflakeKeyGenerator) GenerateKey(msg *Message) ([]byte, error) {
+	return []byte(strconv.FormatInt(g.nextID(), 10)), nil
+}
+
+// fieldHashKeyGenerator generates keys from a hash of JSON value fields
+type fieldHashKeyGenerator struct {
+	fields [][]string
+}
+
+// NewFieldHashKeyGenerator returns a KeyGenerator generating keys from
+// a hash of the given fields of the message value, which must be a
+// JSON object, so that messages with identical field values get identical
+// keys, and thus partitions.
+//
+// Nested fields are specified with a dot-separated path, e.g. "customer.id".
+// Missing fields hash as JSON null.
+// The key is the hex-encoded 64-bit FNV-1a hash of the field values.
+func NewFieldHashKeyGenerator(fields ...string) (KeyGenerator, error) {
+	if len(fields) == 0 {
+		return nil, newErrorFromString(ErrInvalidArg, "At least one field is required")
+	}
+
+	g := &fieldHashKeyGenerator{}
+	for _, field := range fields {
+		if field == "" {
+			return nil, newErrorFromString(ErrInvalidArg, "Empty field name")
+		}
+		g.fields = append(g.fields, strings.Split(field, "."))
+	}
+
+	return g, nil
+}
+
+// GenerateKey implements KeyGenerator
+func (g *fieldHashKeyGenerator) GenerateKey(msg *Message) ([]byte, error) {
+	var value map[string]interface{}
+	err := json.Unmarshal(msg.Value, &value)
+	if err != nil {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Unable to generate key from non-JSON-object message value: %s", err))
+	}
+
+	h := fnv.New64a()
+	for _, path := range g.fields {
+		var field interface{} = value
+		for _, name := range path {
+			obj, ok := field.(map[string]interface{})
+			if !ok {
+				field = nil
+				break
+			}
+			field = obj[name]
+		}
+
+		// encoding/json sorts map keys so nested objects
+		// are encoded consistently.
+		encoded, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(encoded)
+		h.Write([]byte{0})
+	}
+
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], h.Sum64())
+
+	key := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(key, sum[:])
+
+	return key, nil
+}
+
+// keyGeneratorInterceptor generates keys for keyless messages
+type keyGeneratorInterceptor struct {
+	generator KeyGenerator
+}
+
+// NewKeyGeneratorInterceptor returns a ProduceInterceptor generating keys
+// for messages produced without a key (nil Message.Key) with generator,
+// centralizing the partition distribution policy for keyless messages.
+// See Producer.AddProduceInterceptor()
+//
+// Messages produced with an explicit key, including an empty key,
+// are produced unmodified.
+func NewKeyGeneratorInterceptor(generator KeyGenerator) (ProduceInterceptor, error) {
+	if generator == nil {
+		return nil, newErrorFromString(ErrInvalidArg, "KeyGenerator must not be nil")
+	}
+
+	return &keyGeneratorInterceptor{generator: generator}, nil
+}
+
+// OnProduce implements ProduceInterceptor by generating a key for msg
+// if it has none.
+func (ki *keyGeneratorInterceptor) OnProduce(msg *Message) error {
+	if msg.Key != nil {
+		return nil
+	}
+
+	key, err := ki.generator.GenerateKey(msg)
+	if err != nil {
+		return err
+	}
+	msg.Key = key
+
+	return nil
+}
@@ -0,0 +1,154 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// TestUUIDv7KeyGenerator tests UUID v7 key format
+func TestUUIDv7KeyGenerator(t *testing.T) {
+	g := NewUUIDv7KeyGenerator()
+	uuidRe := regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$")
+
+	prev := ""
+	for i := 0; i < 100; i++ {
+		key, err := g.GenerateKey(&Message{})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if !uuidRe.Match(key) {
+			t.Fatalf("Invalid UUID v7 key: %s", key)
+		}
+		if string(key) == prev {
+			t.Fatalf("Duplicate key %s", key)
+		}
+		prev = string(key)
+	}
+}
+
+// TestSnowflakeKeyGenerator tests snowflake key uniqueness and ordering
+func TestSnowflakeKeyGenerator(t *testing.T) {
+	_, err := NewSnowflakeKeyGenerator(1024)
+	if err == nil {
+		t.Fatalf("Expected NewSnowflakeKeyGenerator() to fail with node id 1024")
+	}
+
+	g, err := NewSnowflakeKeyGenerator(5)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var prev int64
+	for i := 0; i < 10000; i++ {
+		key, err := g.GenerateKey(&Message{})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		id, err := strconv.ParseInt(string(key), 10, 64)
+		if err != nil {
+			t.Fatalf("Invalid snowflake key %s: %s", key, err)
+		}
+		if id <= prev {
+			t.Fatalf("Expected increasing ids, got %d after %d", id, prev)
+		}
+		if (id>>snowflakeSeqBits)&snowflakeMaxNode != 5 {
+			t.Fatalf("Expected node id 5 in %d", id)
+		}
+		prev = id
+	}
+}
+
+// TestFieldHashKeyGenerator tests field hash key generation
+func TestFieldHashKeyGenerator(t *testing.T) {
+	_, err := NewFieldHashKeyGenerator()
+	if err == nil {
+		t.Fatalf("Expected NewFieldHashKeyGenerator() to fail without fields")
+	}
+
+	g, err := NewFieldHashKeyGenerator("customer.id", "region")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	genKey := func(value string) string {
+		key, err := g.GenerateKey(&Message{Value: []byte(value)})
+		if err != nil {
+			t.Fatalf("GenerateKey(%s) failed: %s", value, err)
+		}
+		return string(key)
+	}
+
+	k1 := genKey(`{"customer": {"id": 12, "name": "a"}, "region": "eu", "amount": 1}`)
+	k2 := genKey(`{"amount": 2, "region": "eu", "customer": {"name": "b", "id": 12}}`)
+	k3 := genKey(`{"customer": {"id": 13}, "region": "eu"}`)
+
+	if k1 != k2 {
+		t.Errorf("Expected identical keys for identical fields, got %s and %s", k1, k2)
+	}
+	if k1 == k3 {
+		t.Errorf("Expected different keys for different fields, got %s", k1)
+	}
+	if len(k1) != 16 {
+		t.Errorf("Expected 16 character key, not %s", k1)
+	}
+
+	_, err = g.GenerateKey(&Message{Value: []byte("not json")})
+	if err == nil {
+		t.Errorf("Expected GenerateKey() to fail for non-JSON value")
+	}
+}
+
+// TestKeyGeneratorInterceptor tests key generation for keyless messages,
+// no broker is needed.
+func TestKeyGeneratorInterceptor(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	ki, err := NewKeyGeneratorInterceptor(KeyGeneratorFunc(func(msg *Message) ([]byte, error) {
+		return []byte("generated"), nil
+	}))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	p.AddProduceInterceptor(ki)
+
+	topic := "gotest"
+	keyless := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}}
+	keyed := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}, Key: []byte{}}
+
+	for _, msg := range []*Message{keyless, keyed} {
+		err = p.Produce(msg, nil)
+		if err != nil {
+			t.Errorf("Produce failed: %s", err)
+		}
+	}
+
+	if string(keyless.Key) != "generated" {
+		t.Errorf("Expected generated key, not %s", keyless.Key)
+	}
+	if keyed.Key == nil || len(keyed.Key) != 0 {
+		t.Errorf("Expected empty key to be retained, not %v", keyed.Key)
+	}
+}
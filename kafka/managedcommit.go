@@ -0,0 +1,171 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"sort"
+	"sync"
+)
+
+// processedMarks tracks the consumed, not yet processed, offsets of
+// a partition
+type processedMarks struct {
+	// in-flight offsets, in ascending order
+	inflight []Offset
+	// highest consumed offset + 1
+	next Offset
+	// last stored offset, initially the first consumed offset
+	stored Offset
+}
+
+// processedTracker tracks the processing of consumed messages, per
+// partition, to find the offsets up to which all messages are processed
+// (managed commit mode, go.managed.commit.enable).
+type processedTracker struct {
+	lock sync.Mutex
+	// marks per topic and partition
+	marks map[string]map[int32]*processedMarks
+}
+
+// newProcessedTracker creates a new processedTracker without marks
+func newProcessedTracker() *processedTracker {
+	return &processedTracker{marks: make(map[string]map[int32]*processedMarks)}
+}
+
+// consumed records msg as consumed and awaiting processing
+func (t *processedTracker) consumed(msg *Message) {
+	tp := msg.TopicPartition
+	if tp.Topic == nil || tp.Error != nil || tp.Offset < 0 {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	partitions, found := t.marks[*tp.Topic]
+	if !found {
+		partitions = make(map[int32]*processedMarks)
+		t.marks[*tp.Topic] = partitions
+	}
+
+	m, found := partitions[tp.Partition]
+	if !found {
+		m = &processedMarks{stored: tp.Offset}
+		partitions[tp.Partition] = m
+	}
+
+	// Offsets are normally consumed in ascending order,
+	// but may be consumed again after a Seek().
+	i := sort.Search(len(m.inflight), func(i int) bool { return m.inflight[i] >= tp.Offset })
+	if i == len(m.inflight) {
+		m.inflight = append(m.inflight, tp.Offset)
+	} else if m.inflight[i] != tp.Offset {
+		m.inflight = append(m.inflight, 0)
+		copy(m.inflight[i+1:], m.inflight[i:])
+		m.inflight[i] = tp.Offset
+	}
+
+	if tp.Offset+1 > m.next {
+		m.next = tp.Offset + 1
+	}
+}
+
+// processed records msg as processed and returns the offset, if it
+// advanced, up to which all consumed messages of its partition are
+// processed: the lowest in-flight offset, or the next offset to consume
+// if all consumed messages are processed.
+func (t *processedTracker) processed(msg *Message) (offset Offset, advanced bool) {
+	tp := msg.TopicPartition
+	if tp.Topic == nil {
+		return OffsetInvalid, false
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	m, found := t.marks[*tp.Topic][tp.Partition]
+	if !found {
+		// Consumed before a rebalance
+		return OffsetInvalid, false
+	}
+
+	i := sort.Search(len(m.inflight), func(i int) bool { return m.inflight[i] >= tp.Offset })
+	if i == len(m.inflight) || m.inflight[i] != tp.Offset {
+		// Unknown or already processed
+		return OffsetInvalid, false
+	}
+	m.inflight = append(m.inflight[:i], m.inflight[i+1:]...)
+
+	offset = m.next
+	if len(m.inflight) > 0 {
+		offset = m.inflight[0]
+	}
+
+	if offset <= m.stored {
+		return OffsetInvalid, false
+	}
+
+	m.stored = offset
+	return offset, true
+}
+
+// reset forgets all marks, e.g., when the assignment changes
+func (t *processedTracker) reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.marks = make(map[string]map[int32]*processedMarks)
+}
+
+// rebalanced forgets the processed marks once a rebalance has been handled:
+// previously consumed messages are no longer committable, but may still
+// be marked processed from the RebalanceCb.
+func (c *Consumer) rebalanced() {
+	if c.processed != nil {
+		c.processed.reset()
+	}
+}
+
+// MarkProcessed marks msg, returned by Poll(), ReadMessage() or the
+// Events() channel, as processed, in the managed commit mode enabled
+// by the `go.managed.commit.enable` configuration property.
+//
+// Messages may be marked processed in any order, and from any goroutine:
+// the offset of a partition is only stored, for commit by the auto
+// commit interval, rebalances and Close(), once all of its consumed
+// messages up to that offset are processed, so that messages are never
+// committed before they are processed.
+//
+// Messages consumed before the latest rebalance are ignored,
+// since their partition may have been assigned to another consumer,
+// unless marked processed from the RebalanceCb revoking their partition
+// (before calling Unassign()).
+func (c *Consumer) MarkProcessed(msg *Message) error {
+	if c.processed == nil {
+		return newErrorFromString(ErrState,
+			"Managed commit mode not enabled, see go.managed.commit.enable")
+	}
+
+	offset, advanced := c.processed.processed(msg)
+	if !advanced {
+		return nil
+	}
+
+	tp := msg.TopicPartition
+	_, err := c.StoreOffsets([]TopicPartition{{Topic: tp.Topic, Partition: tp.Partition, Offset: offset}})
+	return err
+}
@@ -0,0 +1,134 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+)
+
+// TestProcessedTracker tests that only contiguously processed offsets
+// are committable.
+func TestProcessedTracker(t *testing.T) {
+	tracker := newProcessedTracker()
+
+	topic := "gotest"
+	msgs := make([]*Message, 5)
+	for i := range msgs {
+		msgs[i] = &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 1, Offset: Offset(10 + i)}}
+		tracker.consumed(msgs[i])
+	}
+
+	expect := func(msg *Message, expOffset Offset, expAdvanced bool) {
+		offset, advanced := tracker.processed(msg)
+		if advanced != expAdvanced || (advanced && offset != expOffset) {
+			t.Errorf("processed(%v): expected %v, %v, not %v, %v",
+				msg.TopicPartition, expOffset, expAdvanced, offset, advanced)
+		}
+	}
+
+	// Out of order processing holds back the commit
+	expect(msgs[1], 0, false)
+	expect(msgs[2], 0, false)
+	expect(msgs[0], 13, true)
+	// Already processed
+	expect(msgs[0], 0, false)
+	expect(msgs[4], 0, false)
+	expect(msgs[3], 15, true)
+
+	// Re-consumed after a seek
+	tracker.consumed(msgs[3])
+	tracker.consumed(msgs[4])
+	expect(msgs[3], 0, false)
+
+	// Consumed before a rebalance
+	tracker.reset()
+	expect(msgs[4], 0, false)
+}
+
+// TestConsumerMarkProcessed tests MarkProcessed() without a broker.
+func TestConsumerMarkProcessed(t *testing.T) {
+	topic := "gotest"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0, Offset: 5}}
+
+	c, err := NewConsumer(&ConfigMap{
+		"group.id":          "gotest",
+		"socket.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = c.MarkProcessed(msg)
+	if err == nil || err.(Error).Code() != ErrState {
+		t.Errorf("Expected ErrState without managed commit mode, not %v", err)
+	}
+	c.Close()
+
+	c, err = NewConsumer(&ConfigMap{
+		"group.id":                 "gotest",
+		"socket.timeout.ms":        10,
+		"go.managed.commit.enable": true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer c.Close()
+
+	// Not consumed by this consumer: ignored
+	err = c.MarkProcessed(msg)
+	if err != nil {
+		t.Errorf("MarkProcessed() failed: %s", err)
+	}
+
+	// Not assigned: the offset can't be stored
+	c.processed.consumed(msg)
+	err = c.MarkProcessed(msg)
+	if err != nil && err.(Error).Code() != ErrUnknownPartition {
+		t.Errorf("MarkProcessed() failed: %s", err)
+	}
+}
+
+// TestConsumerMarkProcessedRebalance tests that messages marked processed
+// from the RebalanceCb are still tracked, and are ignored after the
+// rebalance, no broker is needed.
+func TestConsumerMarkProcessedRebalance(t *testing.T) {
+	topic := "gotest"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0, Offset: 5}}
+
+	c, err := NewConsumer(&ConfigMap{
+		"group.id":                 "gotest",
+		"socket.timeout.ms":        10,
+		"go.managed.commit.enable": true})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer c.Close()
+
+	c.rebalanceCb = func(c *Consumer, ev Event) error {
+		c.MarkProcessed(msg)
+		if m := c.processed.marks[topic][0]; m == nil || m.stored != 6 {
+			t.Errorf("Expected offset 6 to be stored from the RebalanceCb, got %+v", m)
+		}
+		return nil
+	}
+
+	c.processed.consumed(msg)
+	c.rebalance(RevokedPartitions{Partitions: []TopicPartition{msg.TopicPartition}})
+	c.rebalanced()
+
+	if len(c.processed.marks) != 0 {
+		t.Errorf("Expected marks to be reset after the rebalance, got %v", c.processed.marks)
+	}
+}
@@ -92,6 +92,48 @@ func (m *Message) String() string {
 	return fmt.Sprintf("%s[%d]@%s", topic, m.TopicPartition.Partition, m.TopicPartition.Offset)
 }
 
+// Copy returns a deep copy of the message: the copy does not share the
+// Key, Value, Headers, topic name or metadata memory of m, while Opaque
+// is copied by value.
+//
+// Produce() copies the message contents before returning, but messages
+// sent on ProduceChannel() are only copied once the producer dequeues
+// them: the application must not modify their buffers until their
+// delivery report is received, or send a Copy() of the message instead.
+func (m *Message) Copy() *Message {
+	c := *m
+
+	if m.TopicPartition.Topic != nil {
+		topic := *m.TopicPartition.Topic
+		c.TopicPartition.Topic = &topic
+	}
+
+	if m.TopicPartition.Metadata != nil {
+		metadata := *m.TopicPartition.Metadata
+		c.TopicPartition.Metadata = &metadata
+	}
+
+	if m.Value != nil {
+		c.Value = append([]byte{}, m.Value...)
+	}
+
+	if m.Key != nil {
+		c.Key = append([]byte{}, m.Key...)
+	}
+
+	if m.Headers != nil {
+		c.Headers = make([]Header, len(m.Headers))
+		for i, hdr := range m.Headers {
+			c.Headers[i] = Header{Key: hdr.Key}
+			if hdr.Value != nil {
+				c.Headers[i].Value = append([]byte{}, hdr.Value...)
+			}
+		}
+	}
+
+	return &c
+}
+
 func (h *handle) getRktFromMessage(msg *Message) (crkt *C.rd_kafka_topic_t) {
 	if msg.TopicPartition.Topic == nil {
 		return nil
@@ -31,3 +31,37 @@ func TestTimestampType(t *testing.T) {
 		}
 	}
 }
+
+// TestMessageCopy tests that Message.Copy() shares no buffers
+func TestMessageCopy(t *testing.T) {
+	topic := "gotest"
+	metadata := "metadata"
+	m := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 3, Metadata: &metadata},
+		Key:     []byte("key"),
+		Value:   []byte("value"),
+		Headers: []Header{{"hdr", []byte("hdrval")}, {"null", nil}},
+		Opaque:  "opaque"}
+
+	c := m.Copy()
+
+	topic = "changed"
+	metadata = "changed"
+	m.Key[0] = 'K'
+	m.Value[0] = 'V'
+	m.Headers[0].Value[0] = 'H'
+
+	if *c.TopicPartition.Topic != "gotest" || c.TopicPartition.Partition != 3 ||
+		*c.TopicPartition.Metadata != "metadata" ||
+		string(c.Key) != "key" || string(c.Value) != "value" ||
+		string(c.Headers[0].Value) != "hdrval" || c.Headers[1].Value != nil ||
+		c.Opaque != "opaque" {
+		t.Errorf("Copy %v (key %s, value %s, headers %v) modified by changes to the original",
+			c, c.Key, c.Value, c.Headers)
+	}
+
+	empty := (&Message{}).Copy()
+	if empty.TopicPartition.Topic != nil || empty.TopicPartition.Metadata != nil ||
+		empty.Key != nil || empty.Value != nil || empty.Headers != nil {
+		t.Errorf("Expected empty copy of empty message, got %v", empty)
+	}
+}
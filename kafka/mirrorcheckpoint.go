@@ -0,0 +1,262 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// MirrorCheckpoint is a consumer group offset checkpoint emitted by
+// MirrorMaker 2 on the target cluster's `<source>.checkpoints.internal`
+// topic, mapping the group's committed offset on the source (upstream)
+// cluster to the corresponding offset on the target (downstream) cluster.
+type MirrorCheckpoint struct {
+	// Group is the consumer group id.
+	Group string
+	// TopicPartition is the downstream (renamed) topic and partition,
+	// with the translated downstream Offset.
+	TopicPartition TopicPartition
+	// UpstreamOffset is the group's committed offset on the source cluster.
+	UpstreamOffset Offset
+	// Metadata is the group's commit metadata.
+	Metadata string
+}
+
+// String returns a human-readable representation of a MirrorCheckpoint.
+func (cp MirrorCheckpoint) String() string {
+	return fmt.Sprintf("MirrorCheckpoint(%s, %v, upstream %v)",
+		cp.Group, cp.TopicPartition, cp.UpstreamOffset)
+}
+
+// checkpointReader decodes the Kafka protocol primitive types used by
+// MirrorMaker 2 checkpoint records.
+type checkpointReader struct {
+	buf []byte
+	err error
+}
+
+func (r *checkpointReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = newErrorFromString(ErrBadMsg, "Truncated MirrorMaker checkpoint record")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *checkpointReader) int16() int16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *checkpointReader) int32() int32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *checkpointReader) int64() int64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (r *checkpointReader) string() string {
+	n := r.int16()
+	b := r.take(int(n))
+	if b == nil {
+		return ""
+	}
+	return string(b)
+}
+
+// ParseMirrorCheckpoint parses a MirrorMaker 2 checkpoint record's
+// key and value.
+// Only checkpoint record version 0 is supported.
+func ParseMirrorCheckpoint(key []byte, value []byte) (*MirrorCheckpoint, error) {
+	cp := &MirrorCheckpoint{}
+
+	kr := &checkpointReader{buf: key}
+	cp.Group = kr.string()
+	topic := kr.string()
+	cp.TopicPartition.Topic = &topic
+	cp.TopicPartition.Partition = kr.int32()
+	if kr.err != nil {
+		return nil, kr.err
+	}
+
+	vr := &checkpointReader{buf: value}
+	version := vr.int16()
+	if vr.err == nil && version != 0 {
+		return nil, newErrorFromString(ErrBadMsg,
+			fmt.Sprintf("Unsupported MirrorMaker checkpoint version %d", version))
+	}
+	cp.UpstreamOffset = Offset(vr.int64())
+	cp.TopicPartition.Offset = Offset(vr.int64())
+	cp.Metadata = vr.string()
+	if vr.err != nil {
+		return nil, vr.err
+	}
+
+	return cp, nil
+}
+
+// MirrorOffsetTranslator translates consumer group offsets committed on a
+// source cluster to offsets on a target cluster mirrored by MirrorMaker 2,
+// based on the checkpoints read from the target cluster's checkpoint topic,
+// so that consumers failing over to the target cluster resume
+// close to their original position.
+//
+// MirrorOffsetTranslator is safe for concurrent use.
+type MirrorOffsetTranslator struct {
+	lock sync.Mutex
+	// group -> "topic\x00partition" -> latest checkpoint
+	checkpoints map[string]map[string]*MirrorCheckpoint
+}
+
+// NewMirrorOffsetTranslator creates a new MirrorOffsetTranslator without
+// any checkpoints.
+func NewMirrorOffsetTranslator() *MirrorOffsetTranslator {
+	return &MirrorOffsetTranslator{checkpoints: make(map[string]map[string]*MirrorCheckpoint)}
+}
+
+// Add parses and adds the checkpoint record msg, superseding any
+// previous checkpoint for the same group and partition.
+func (t *MirrorOffsetTranslator) Add(msg *Message) error {
+	cp, err := ParseMirrorCheckpoint(msg.Key, msg.Value)
+	if err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	group, found := t.checkpoints[cp.Group]
+	if !found {
+		group = make(map[string]*MirrorCheckpoint)
+		t.checkpoints[cp.Group] = group
+	}
+	group[fmt.Sprintf("%s\x00%d", *cp.TopicPartition.Topic, cp.TopicPartition.Partition)] = cp
+
+	return nil
+}
+
+// Load reads all checkpoints currently in checkpointTopic, e.g.
+// "us-east.checkpoints.internal", on the target cluster given by conf
+// (which must contain at least `bootstrap.servers`).
+func (t *MirrorOffsetTranslator) Load(ctx context.Context, conf *ConfigMap, checkpointTopic string) error {
+	admin, err := NewAdminClient(conf)
+	if err != nil {
+		return err
+	}
+	md, err := admin.GetMetadata(&checkpointTopic, false, 10*1000)
+	admin.Close()
+	if err != nil {
+		return err
+	}
+
+	tmd, found := md.Topics[checkpointTopic]
+	if !found || tmd.Error.Code() != ErrNoError {
+		return newErrorFromString(ErrUnknownTopic,
+			fmt.Sprintf("Checkpoint topic %s not found", checkpointTopic))
+	}
+
+	for _, p := range tmd.Partitions {
+		r, err := NewPartitionReader(conf, checkpointTopic, p.ID, OffsetBeginning)
+		if err != nil {
+			return err
+		}
+
+		for {
+			msg, err := r.ReadMessage(ctx)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				r.Close()
+				return err
+			}
+
+			if msg.Value == nil {
+				// Not a checkpoint
+				continue
+			}
+
+			err = t.Add(msg)
+			if err != nil {
+				r.Close()
+				return err
+			}
+		}
+
+		r.Close()
+	}
+
+	return nil
+}
+
+// Checkpoints returns the latest checkpoint for each partition of group,
+// sorted by topic and partition.
+func (t *MirrorOffsetTranslator) Checkpoints(group string) []MirrorCheckpoint {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var tps TopicPartitions
+	byPartition := make(map[string]*MirrorCheckpoint)
+	for key, cp := range t.checkpoints[group] {
+		tps = append(tps, cp.TopicPartition)
+		byPartition[key] = cp
+	}
+
+	sort.Sort(tps)
+
+	checkpoints := make([]MirrorCheckpoint, len(tps))
+	for i, tp := range tps {
+		checkpoints[i] = *byPartition[fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition)]
+	}
+
+	return checkpoints
+}
+
+// Translate returns the translated downstream offsets for group,
+// suitable for Consumer.Assign() or Consumer.CommitOffsets() on the
+// target cluster.
+func (t *MirrorOffsetTranslator) Translate(group string) []TopicPartition {
+	checkpoints := t.Checkpoints(group)
+
+	offsets := make([]TopicPartition, len(checkpoints))
+	for i, cp := range checkpoints {
+		offsets[i] = cp.TopicPartition
+	}
+
+	return offsets
+}
@@ -0,0 +1,140 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// checkpointRecord returns a MirrorMaker 2 checkpoint record key and value
+func checkpointRecord(group string, topic string, partition int32, upstream int64, downstream int64, metadata string) (key []byte, value []byte) {
+	putString := func(b []byte, s string) []byte {
+		b = append(b, byte(len(s)>>8), byte(len(s)))
+		return append(b, s...)
+	}
+
+	key = putString(key, group)
+	key = putString(key, topic)
+	key = append(key, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(key[len(key)-4:], uint32(partition))
+
+	value = []byte{0, 0} // version 0
+	value = append(value, make([]byte, 16)...)
+	binary.BigEndian.PutUint64(value[2:], uint64(upstream))
+	binary.BigEndian.PutUint64(value[10:], uint64(downstream))
+	value = putString(value, metadata)
+
+	return key, value
+}
+
+// TestParseMirrorCheckpoint tests checkpoint record parsing
+func TestParseMirrorCheckpoint(t *testing.T) {
+	key, value := checkpointRecord("mygroup", "us-east.orders", 3, 1000, 987, "meta")
+
+	cp, err := ParseMirrorCheckpoint(key, value)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if cp.Group != "mygroup" || *cp.TopicPartition.Topic != "us-east.orders" ||
+		cp.TopicPartition.Partition != 3 || cp.TopicPartition.Offset != 987 ||
+		cp.UpstreamOffset != 1000 || cp.Metadata != "meta" {
+		t.Errorf("Unexpected checkpoint %v (metadata %s)", cp, cp.Metadata)
+	}
+
+	_, err = ParseMirrorCheckpoint(key[:len(key)-1], value)
+	if err == nil || err.(Error).Code() != ErrBadMsg {
+		t.Errorf("Expected ErrBadMsg for truncated key, got %v", err)
+	}
+
+	_, err = ParseMirrorCheckpoint(key, value[:10])
+	if err == nil || err.(Error).Code() != ErrBadMsg {
+		t.Errorf("Expected ErrBadMsg for truncated value, got %v", err)
+	}
+
+	value[1] = 1
+	_, err = ParseMirrorCheckpoint(key, value)
+	if err == nil || err.(Error).Code() != ErrBadMsg {
+		t.Errorf("Expected ErrBadMsg for unsupported version, got %v", err)
+	}
+}
+
+// TestMirrorOffsetTranslator tests that the latest checkpoint per
+// group and partition is used for translation, no broker is needed.
+func TestMirrorOffsetTranslator(t *testing.T) {
+	tr := NewMirrorOffsetTranslator()
+
+	records := []struct {
+		group      string
+		topic      string
+		partition  int32
+		upstream   int64
+		downstream int64
+	}{
+		{"g1", "src.t2", 0, 10, 8},
+		{"g1", "src.t1", 1, 20, 19},
+		{"g1", "src.t1", 0, 30, 25},
+		{"g2", "src.t1", 0, 5, 4},
+		{"g1", "src.t1", 1, 40, 37},
+	}
+
+	for _, r := range records {
+		key, value := checkpointRecord(r.group, r.topic, r.partition, r.upstream, r.downstream, "")
+		err := tr.Add(&Message{Key: key, Value: value})
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	err := tr.Add(&Message{Key: []byte{0}, Value: []byte{0}})
+	if err == nil {
+		t.Errorf("Expected Add() of invalid record to fail")
+	}
+
+	offsets := tr.Translate("g1")
+	expected := []struct {
+		topic     string
+		partition int32
+		offset    Offset
+	}{
+		{"src.t1", 0, 25},
+		{"src.t1", 1, 37},
+		{"src.t2", 0, 8},
+	}
+
+	if len(offsets) != len(expected) {
+		t.Fatalf("Expected %d offsets, got %v", len(expected), offsets)
+	}
+
+	for i, exp := range expected {
+		tp := offsets[i]
+		if *tp.Topic != exp.topic || tp.Partition != exp.partition || tp.Offset != exp.offset {
+			t.Errorf("Offset #%d: expected %s [%d] @ %v, got %v",
+				i, exp.topic, exp.partition, exp.offset, tp)
+		}
+	}
+
+	checkpoints := tr.Checkpoints("g2")
+	if len(checkpoints) != 1 || checkpoints[0].UpstreamOffset != 5 {
+		t.Errorf("Unexpected g2 checkpoints %v", checkpoints)
+	}
+
+	if len(tr.Translate("unknown")) != 0 {
+		t.Errorf("Expected no offsets for unknown group")
+	}
+}
@@ -0,0 +1,121 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"time"
+)
+
+// Send produces a single message with key and value to topic and waits
+// for its delivery, creating and closing a Producer for the purpose.
+//
+// Send is intended for scripts, tools and tests: applications producing
+// more than the occasional message should use a long-lived Producer.
+//
+// conf must contain at least `bootstrap.servers`.
+// Returns the delivery error, if any, or ctx.Err() if ctx is done
+// before the message is delivered.
+func Send(ctx context.Context, conf *ConfigMap, topic string, key []byte, value []byte) error {
+	p, err := NewProducer(conf)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	_, err = p.ProduceSync(ctx, &Message{
+		TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny},
+		Key:            key,
+		Value:          value,
+	})
+	return err
+}
+
+// Receive consumes up to n messages from topic, creating and closing a
+// Consumer for the purpose.
+// See ReceiveUntil()
+func Receive(ctx context.Context, conf *ConfigMap, topic string, n int) ([]*Message, error) {
+	if n <= 0 {
+		return nil, newErrorFromString(ErrInvalidArg, "n must be positive")
+	}
+
+	return ReceiveUntil(ctx, conf, topic, func(msgs []*Message) bool {
+		return len(msgs) >= n
+	})
+}
+
+// ReceiveUntil consumes messages from topic until done returns true,
+// creating and closing a Consumer for the purpose.
+// done is called with all messages received so far after each message.
+//
+// ReceiveUntil is intended for scripts, tools and tests.
+//
+// conf must contain at least `bootstrap.servers`.
+// Unless configured in conf, `group.id` defaults to "go-receive",
+// `auto.offset.reset` to "earliest" and offsets are not committed, so
+// that the topic is consumed from the beginning each time.
+//
+// Returns the received messages, and ctx.Err() if ctx is done before
+// done returns true, or a fatal or partition error.
+func ReceiveUntil(ctx context.Context, conf *ConfigMap, topic string, done func(msgs []*Message) bool) ([]*Message, error) {
+	confCopy := conf.clone()
+	if v, _ := confCopy.get("group.id", nil); v == nil {
+		confCopy.SetKey("group.id", "go-receive")
+		confCopy.SetKey("enable.auto.commit", false)
+	}
+	if v, _ := confCopy.get("auto.offset.reset", nil); v == nil {
+		confCopy.SetKey("auto.offset.reset", "earliest")
+	}
+	confCopy.SetKey("go.events.channel.enable", false)
+
+	c, err := NewConsumer(&confCopy)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	err = c.Subscribe(topic, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*Message
+
+	for {
+		select {
+		case <-ctx.Done():
+			return msgs, ctx.Err()
+		default:
+		}
+
+		msg, err := c.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			kerr, ok := err.(Error)
+			if ok && msg == nil && !kerr.IsFatal() {
+				// Timeout or transient client error:
+				// the client recovers automatically.
+				continue
+			}
+			return msgs, err
+		}
+
+		msgs = append(msgs, msg)
+		if done(msgs) {
+			return msgs, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestSend tests that Send() reports delivery failure, no broker is needed.
+func TestSend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := Send(ctx, &ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10},
+		"gotest", []byte("key"), []byte("value"))
+	t.Logf("Send() returned %v", err)
+	if err == nil || err == context.DeadlineExceeded {
+		t.Errorf("Expected Send() to fail with a delivery error, got %v", err)
+	}
+}
+
+// TestReceive tests that Receive() honours the context, no broker is needed.
+func TestReceive(t *testing.T) {
+	conf := &ConfigMap{"socket.timeout.ms": 10}
+
+	_, err := Receive(context.Background(), conf, "gotest", 0)
+	if err == nil || err.(Error).Code() != ErrInvalidArg {
+		t.Errorf("Expected ErrInvalidArg for n=0, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	msgs, err := Receive(ctx, conf, "gotest", 1)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected Receive() to time out, got %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("Expected no messages, got %v", msgs)
+	}
+
+	if _, found := (*conf)["group.id"]; found {
+		t.Errorf("Original config modified: %v", conf)
+	}
+}
@@ -0,0 +1,241 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// defaultReplicaLagTime is the broker default of replica.lag.time.max.ms
+const defaultReplicaLagTime = 10 * time.Second
+
+// PartitionDescription describes the replicas and offsets of a topic
+// partition, see AdminClient.DescribeTopicPartitions().
+type PartitionDescription struct {
+	Topic     string
+	Partition int32
+	Leader    int32
+	Replicas  []int32
+	Isrs      []int32
+	// OutOfSyncReplicas are the replicas not in the in-sync replica set.
+	OutOfSyncReplicas []int32
+	LowWatermark      int64
+	HighWatermark     int64
+	// AppendRate is the number of messages appended to the partition
+	// per second during the sample interval, 0 if not sampled.
+	AppendRate float64
+	// EstimatedReplicaLag is a rough, heuristic, estimate of the number
+	// of messages the out-of-sync replicas are behind the leader, 0 if all
+	// replicas are in sync or the partition was not sampled.
+	//
+	// The brokers do not expose follower offsets to clients, the estimate
+	// is instead the number of messages appended during the broker's
+	// replica.lag.time.max.ms. It is neither a lower nor an upper bound:
+	// a follower removed from the in-sync replica set may be only
+	// slightly behind, or much further behind once it has stopped
+	// fetching. Use it to compare partitions, not as an exact lag.
+	EstimatedReplicaLag int64
+	// Error, if any, of the partition's metadata or offsets.
+	Error Error
+}
+
+// UnderReplicated returns true if not all replicas of the partition are in sync.
+func (d PartitionDescription) UnderReplicated() bool {
+	return len(d.OutOfSyncReplicas) > 0
+}
+
+// String returns a human-readable representation of a PartitionDescription.
+func (d PartitionDescription) String() string {
+	return fmt.Sprintf("%s[%d] leader %d, replicas %v, isrs %v, offsets %d..%d, estimated replica lag %d",
+		d.Topic, d.Partition, d.Leader, d.Replicas, d.Isrs,
+		d.LowWatermark, d.HighWatermark, d.EstimatedReplicaLag)
+}
+
+// partitionDescriber describes topic partitions with pluggable cluster
+// queries, allowing it to be tested without a broker.
+type partitionDescriber struct {
+	getMetadata     func(topic *string, allTopics bool, timeoutMs int) (*Metadata, error)
+	queryWatermarks func(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+	replicaLagTime  func(ctx context.Context, broker int32) time.Duration
+}
+
+// DescribeTopicPartitions describes the replicas and offsets of all
+// partitions of topics, for health and capacity monitoring, combining
+// cluster metadata, partition watermark offsets and the brokers'
+// replica lag configuration.
+//
+// If sampleInterval is non-zero the watermarks are queried twice,
+// sampleInterval apart, to measure each partition's append rate
+// and estimate the lag of its out-of-sync replicas,
+// see PartitionDescription.EstimatedReplicaLag.
+//
+// timeoutMs is the maximum time of each metadata and offsets query.
+// Partition errors are returned in PartitionDescription.Error.
+func (a *AdminClient) DescribeTopicPartitions(ctx context.Context, topics []string, sampleInterval time.Duration, timeoutMs int) ([]PartitionDescription, error) {
+	d := partitionDescriber{
+		getMetadata: a.GetMetadata,
+		queryWatermarks: func(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+			return queryWatermarkOffsets(a, topic, partition, timeoutMs)
+		},
+		replicaLagTime: a.replicaLagTime,
+	}
+
+	return d.describe(ctx, topics, sampleInterval, timeoutMs)
+}
+
+// replicaLagTime returns broker's replica.lag.time.max.ms,
+// or the broker default if it can't be retrieved.
+func (a *AdminClient) replicaLagTime(ctx context.Context, broker int32) time.Duration {
+	results, err := a.DescribeConfigs(ctx, []ConfigResource{{
+		Type: ResourceBroker,
+		Name: strconv.Itoa(int(broker)),
+	}})
+	if err != nil || len(results) != 1 || results[0].Error.Code() != ErrNoError {
+		return defaultReplicaLagTime
+	}
+
+	entry, found := results[0].Config["replica.lag.time.max.ms"]
+	if !found {
+		return defaultReplicaLagTime
+	}
+
+	ms, err := strconv.ParseInt(entry.Value, 10, 64)
+	if err != nil {
+		return defaultReplicaLagTime
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// describe implements DescribeTopicPartitions()
+func (d partitionDescriber) describe(ctx context.Context, topics []string, sampleInterval time.Duration, timeoutMs int) ([]PartitionDescription, error) {
+	var descs []PartitionDescription
+
+	for _, topic := range topics {
+		topic := topic
+		md, err := d.getMetadata(&topic, false, timeoutMs)
+		if err != nil {
+			return nil, err
+		}
+
+		tmd, found := md.Topics[topic]
+		if !found {
+			return nil, newErrorFromString(ErrUnknownTopic,
+				fmt.Sprintf("Topic %s not found", topic))
+		}
+		if tmd.Error.Code() != ErrNoError {
+			return nil, tmd.Error
+		}
+
+		for _, p := range tmd.Partitions {
+			desc := PartitionDescription{
+				Topic:     topic,
+				Partition: p.ID,
+				Leader:    p.Leader,
+				Replicas:  p.Replicas,
+				Isrs:      p.Isrs,
+				Error:     p.Error,
+			}
+
+			isr := make(map[int32]bool)
+			for _, id := range p.Isrs {
+				isr[id] = true
+			}
+			for _, id := range p.Replicas {
+				if !isr[id] {
+					desc.OutOfSyncReplicas = append(desc.OutOfSyncReplicas, id)
+				}
+			}
+
+			descs = append(descs, desc)
+		}
+	}
+
+	d.sampleWatermarks(descs, timeoutMs)
+
+	if sampleInterval <= 0 {
+		return descs, nil
+	}
+
+	start := time.Now()
+	first := make([]int64, len(descs))
+	for i := range descs {
+		first[i] = descs[i].HighWatermark
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(sampleInterval):
+	}
+
+	d.sampleWatermarks(descs, timeoutMs)
+	elapsed := time.Since(start).Seconds()
+
+	// Replica lag time per leader broker
+	lagTimes := make(map[int32]time.Duration)
+
+	for i := range descs {
+		desc := &descs[i]
+		if desc.Error.Code() != ErrNoError {
+			continue
+		}
+
+		desc.AppendRate = float64(desc.HighWatermark-first[i]) / elapsed
+
+		if !desc.UnderReplicated() {
+			continue
+		}
+
+		lagTime, found := lagTimes[desc.Leader]
+		if !found {
+			lagTime = d.replicaLagTime(ctx, desc.Leader)
+			lagTimes[desc.Leader] = lagTime
+		}
+
+		desc.EstimatedReplicaLag = int64(desc.AppendRate * lagTime.Seconds())
+	}
+
+	return descs, nil
+}
+
+// sampleWatermarks updates the watermark offsets of descs,
+// recording query errors in the descriptions.
+func (d partitionDescriber) sampleWatermarks(descs []PartitionDescription, timeoutMs int) {
+	for i := range descs {
+		desc := &descs[i]
+		if desc.Error.Code() != ErrNoError {
+			continue
+		}
+
+		low, high, err := d.queryWatermarks(desc.Topic, desc.Partition, timeoutMs)
+		if err != nil {
+			if kerr, ok := err.(Error); ok {
+				desc.Error = kerr
+			} else {
+				desc.Error = newErrorFromString(ErrFail, err.Error())
+			}
+			continue
+		}
+
+		desc.LowWatermark = low
+		desc.HighWatermark = high
+	}
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestDescribeTopicPartitions tests partition descriptions and replica lag
+// estimates from fake cluster queries, no broker is needed.
+func TestDescribeTopicPartitions(t *testing.T) {
+	queries := 0
+	d := partitionDescriber{
+		getMetadata: func(topic *string, allTopics bool, timeoutMs int) (*Metadata, error) {
+			return &Metadata{Topics: map[string]TopicMetadata{
+				*topic: {Topic: *topic, Partitions: []PartitionMetadata{
+					{ID: 0, Leader: 1, Replicas: []int32{1, 2, 3}, Isrs: []int32{1, 2, 3}},
+					{ID: 1, Leader: 2, Replicas: []int32{2, 3, 1}, Isrs: []int32{2}},
+					{ID: 2, Leader: -1, Error: newErrorFromString(ErrLeaderNotAvailable, "Leader not available")},
+				}},
+			}}, nil
+		},
+		queryWatermarks: func(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+			if partition == 2 {
+				t.Errorf("Unexpected watermarks query of errored partition")
+			}
+			queries++
+			// Each partition grows by 100 messages between samples
+			return 5, int64(queries/3) * 100, nil
+		},
+		replicaLagTime: func(ctx context.Context, broker int32) time.Duration {
+			if broker != 2 {
+				t.Errorf("Expected replica lag time query for leader 2, not %d", broker)
+			}
+			return 30 * time.Second
+		},
+	}
+
+	descs, err := d.describe(context.Background(), []string{"gotest"}, 0, 100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(descs) != 3 {
+		t.Fatalf("Expected 3 partition descriptions, not %v", descs)
+	}
+
+	if descs[0].UnderReplicated() || !descs[1].UnderReplicated() {
+		t.Errorf("Unexpected under-replication: %v", descs)
+	}
+
+	if len(descs[1].OutOfSyncReplicas) != 2 ||
+		descs[1].OutOfSyncReplicas[0] != 3 || descs[1].OutOfSyncReplicas[1] != 1 {
+		t.Errorf("Unexpected out-of-sync replicas %v", descs[1].OutOfSyncReplicas)
+	}
+
+	if descs[2].Error.Code() != ErrLeaderNotAvailable {
+		t.Errorf("Expected partition error, not %v", descs[2].Error)
+	}
+
+	if descs[1].EstimatedReplicaLag != 0 || descs[1].LowWatermark != 5 {
+		t.Errorf("Unexpected unsampled description %v", descs[1])
+	}
+
+	queries = 0
+	interval := 50 * time.Millisecond
+	descs, err = d.describe(context.Background(), []string{"gotest"}, interval, 100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// 100 messages per ~50ms is at most 2000 msgs/s,
+	// the out-of-sync replicas are at most 30s * 2000 msgs/s behind.
+	if descs[1].AppendRate <= 0 || descs[1].AppendRate > 2000 {
+		t.Errorf("Unexpected append rate %f", descs[1].AppendRate)
+	}
+	if descs[0].EstimatedReplicaLag != 0 {
+		t.Errorf("Expected no replica lag for in-sync partition, not %d",
+			descs[0].EstimatedReplicaLag)
+	}
+	if descs[1].EstimatedReplicaLag <= 0 || descs[1].EstimatedReplicaLag > 60000 {
+		t.Errorf("Unexpected replica lag estimate %d", descs[1].EstimatedReplicaLag)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.describe(ctx, []string{"gotest"}, time.Hour, 100)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, not %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"sync"
+)
+
+// LowLatencyConfig returns a copy of conf tuned for low produce latency
+// on ordering-critical topics: Nagle's algorithm is disabled on broker
+// sockets and messages are sent without waiting to form batches.
+// Properties already configured in conf are retained.
+func LowLatencyConfig(conf *ConfigMap) *ConfigMap {
+	confCopy := conf.clone()
+
+	for k, v := range map[string]ConfigValue{
+		"socket.nagle.disable":   true,
+		"queue.buffering.max.ms": 0,
+	} {
+		if cur, _ := confCopy.get(k, nil); cur == nil {
+			confCopy.SetKey(k, v)
+		}
+	}
+
+	return &confCopy
+}
+
+// PartitionCountChange is passed to a PartitionPinner's change handler
+// when the partition count of a topic with pinned keys changes.
+type PartitionCountChange struct {
+	Topic    string
+	OldCount int
+	NewCount int
+	// Invalidated are the pins whose partition no longer exists,
+	// they are removed from the pinner.
+	Invalidated []TopicPartition
+}
+
+// String returns a human-readable representation of a PartitionCountChange.
+func (c PartitionCountChange) String() string {
+	return fmt.Sprintf("Topic %s partition count changed from %d to %d (%d pins invalidated)",
+		c.Topic, c.OldCount, c.NewCount, len(c.Invalidated))
+}
+
+// PartitionPinner is a ProduceInterceptor producing messages with pinned
+// keys to a fixed partition, regardless of the configured partitioner, so
+// that the key to partition mapping of ordering-critical keys is explicit
+// and is not silently changed by adding partitions to the topic.
+// See Producer.AddProduceInterceptor()
+//
+// Pins are verified against the topic metadata when added, and all
+// pinned topics are re-verified by Verify(), which should be called
+// periodically to detect partition count changes.
+//
+// Messages without a key, with an unpinned key, or with an explicit
+// partition, are produced unmodified.
+//
+// PartitionPinner is safe for concurrent use.
+type PartitionPinner struct {
+	lock sync.RWMutex
+	// topic -> key -> partition
+	pins map[string]map[string]int32
+	// topic -> last verified partition count
+	partitionCnts map[string]int
+	onChange      func(change PartitionCountChange)
+	getMetadata   func(topic *string, allTopics bool, timeoutMs int) (*Metadata, error)
+}
+
+// NewPartitionPinner creates a new PartitionPinner verifying pins with
+// producer p's metadata, add it to p with p.AddProduceInterceptor().
+// onChange, if not nil, is called by Verify() for each pinned topic whose
+// partition count has changed.
+func NewPartitionPinner(p *Producer, onChange func(change PartitionCountChange)) (*PartitionPinner, error) {
+	if p == nil {
+		return nil, newErrorFromString(ErrInvalidArg, "Producer must not be nil")
+	}
+
+	return &PartitionPinner{
+		pins:          make(map[string]map[string]int32),
+		partitionCnts: make(map[string]int),
+		onChange:      onChange,
+		getMetadata:   p.GetMetadata,
+	}, nil
+}
+
+// topicPartitionCount returns the current partition count of topic,
+// failing if any partition is without a leader.
+func (pp *PartitionPinner) topicPartitionCount(topic string, timeoutMs int) (int, error) {
+	md, err := pp.getMetadata(&topic, false, timeoutMs)
+	if err != nil {
+		return 0, err
+	}
+
+	tmd, found := md.Topics[topic]
+	if !found {
+		return 0, newErrorFromString(ErrUnknownTopic,
+			fmt.Sprintf("Topic %s not found in metadata", topic))
+	}
+	if tmd.Error.Code() != ErrNoError {
+		return 0, tmd.Error
+	}
+
+	for _, p := range tmd.Partitions {
+		if p.Error.Code() != ErrNoError {
+			return 0, p.Error
+		}
+		if p.Leader < 0 {
+			return 0, newErrorFromString(ErrLeaderNotAvailable,
+				fmt.Sprintf("Topic %s partition %d has no leader", topic, p.ID))
+		}
+	}
+
+	return len(tmd.Partitions), nil
+}
+
+// Pin pins key to partition of topic after verifying, with a metadata
+// request of at most timeoutMs, that the partition exists and has a leader.
+// Any previous pin of key on topic is replaced.
+func (pp *PartitionPinner) Pin(topic string, key []byte, partition int32, timeoutMs int) error {
+	if partition < 0 {
+		return newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid partition %d", partition))
+	}
+
+	cnt, err := pp.topicPartitionCount(topic, timeoutMs)
+	if err != nil {
+		return err
+	}
+
+	if int(partition) >= cnt {
+		return newErrorFromString(ErrUnknownPartition,
+			fmt.Sprintf("Topic %s has %d partitions, can't pin key to partition %d",
+				topic, cnt, partition))
+	}
+
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	keys, found := pp.pins[topic]
+	if !found {
+		keys = make(map[string]int32)
+		pp.pins[topic] = keys
+	}
+	keys[string(key)] = partition
+	pp.partitionCnts[topic] = cnt
+
+	return nil
+}
+
+// Unpin removes the pin of key on topic, if any.
+func (pp *PartitionPinner) Unpin(topic string, key []byte) {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	delete(pp.pins[topic], string(key))
+	if len(pp.pins[topic]) == 0 {
+		delete(pp.pins, topic)
+		delete(pp.partitionCnts, topic)
+	}
+}
+
+// Partition returns the partition key is pinned to on topic, if any.
+func (pp *PartitionPinner) Partition(topic string, key []byte) (partition int32, pinned bool) {
+	pp.lock.RLock()
+	defer pp.lock.RUnlock()
+
+	partition, pinned = pp.pins[topic][string(key)]
+	return partition, pinned
+}
+
+// Verify re-verifies the partition count of all pinned topics, with
+// metadata requests of at most timeoutMs each.
+//
+// Pins to partitions that no longer exist are removed and
+// the change handler is called for each topic whose partition count
+// has changed.
+// Returns the first metadata error, if any, after verifying all topics.
+func (pp *PartitionPinner) Verify(timeoutMs int) error {
+	pp.lock.RLock()
+	topics := make([]string, 0, len(pp.pins))
+	for topic := range pp.pins {
+		topics = append(topics, topic)
+	}
+	pp.lock.RUnlock()
+
+	var firstErr error
+	var changes []PartitionCountChange
+
+	for _, topic := range topics {
+		cnt, err := pp.topicPartitionCount(topic, timeoutMs)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		pp.lock.Lock()
+		oldCnt, found := pp.partitionCnts[topic]
+		if found && oldCnt != cnt {
+			change := PartitionCountChange{Topic: topic, OldCount: oldCnt, NewCount: cnt}
+			for key, partition := range pp.pins[topic] {
+				if int(partition) >= cnt {
+					t := topic
+					change.Invalidated = append(change.Invalidated,
+						TopicPartition{Topic: &t, Partition: partition})
+					delete(pp.pins[topic], key)
+				}
+			}
+			pp.partitionCnts[topic] = cnt
+			changes = append(changes, change)
+		}
+		pp.lock.Unlock()
+	}
+
+	if pp.onChange != nil {
+		for _, change := range changes {
+			pp.onChange(change)
+		}
+	}
+
+	return firstErr
+}
+
+// OnProduce implements ProduceInterceptor by setting the partition of msg
+// to its key's pinned partition, unless msg has an explicit partition.
+func (pp *PartitionPinner) OnProduce(msg *Message) error {
+	if msg.Key != nil && msg.TopicPartition.Partition == PartitionAny {
+		if partition, pinned := pp.Partition(*msg.TopicPartition.Topic, msg.Key); pinned {
+			msg.TopicPartition.Partition = partition
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+)
+
+// TestLowLatencyConfig tests that low latency settings do not
+// override explicit configuration
+func TestLowLatencyConfig(t *testing.T) {
+	conf := &ConfigMap{"queue.buffering.max.ms": 5}
+	llConf := LowLatencyConfig(conf)
+
+	if (*llConf)["socket.nagle.disable"] != true || (*llConf)["queue.buffering.max.ms"] != 5 {
+		t.Errorf("Unexpected low latency config %v", llConf)
+	}
+
+	if len(*conf) != 1 {
+		t.Errorf("Original config modified: %v", conf)
+	}
+}
+
+// TestPartitionPinner tests pinning, verification and produce
+// partitioning, no broker is needed.
+func TestPartitionPinner(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	var changes []PartitionCountChange
+	pp, err := NewPartitionPinner(p, func(change PartitionCountChange) {
+		changes = append(changes, change)
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	p.AddProduceInterceptor(pp)
+
+	topic := "pinned"
+	partitionCnt := 4
+	leader := int32(1)
+	pp.getMetadata = func(topic *string, allTopics bool, timeoutMs int) (*Metadata, error) {
+		tmd := TopicMetadata{Topic: *topic}
+		for i := 0; i < partitionCnt; i++ {
+			tmd.Partitions = append(tmd.Partitions,
+				PartitionMetadata{ID: int32(i), Leader: leader})
+		}
+		return &Metadata{Topics: map[string]TopicMetadata{*topic: tmd}}, nil
+	}
+
+	err = pp.Pin(topic, []byte("a"), 3, 100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	err = pp.Pin(topic, []byte("b"), 1, 100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = pp.Pin(topic, []byte("c"), 4, 100)
+	if err == nil || err.(Error).Code() != ErrUnknownPartition {
+		t.Errorf("Expected ErrUnknownPartition for non-existent partition, got %v", err)
+	}
+
+	leader = -1
+	err = pp.Pin(topic, []byte("c"), 0, 100)
+	if err == nil || err.(Error).Code() != ErrLeaderNotAvailable {
+		t.Errorf("Expected ErrLeaderNotAvailable for leaderless partition, got %v", err)
+	}
+	leader = 1
+
+	// Pinned key, unpinned key, explicit partition
+	msgs := []*Message{
+		{TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny}, Key: []byte("a")},
+		{TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny}, Key: []byte("x")},
+		{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}, Key: []byte("a")},
+	}
+	expPartitions := []int32{3, PartitionAny, 0}
+
+	for i, msg := range msgs {
+		err = p.Produce(msg, nil)
+		if err != nil {
+			t.Fatalf("Produce failed: %s", err)
+		}
+		if msg.TopicPartition.Partition != expPartitions[i] {
+			t.Errorf("Message #%d: expected partition %d, got %d",
+				i, expPartitions[i], msg.TopicPartition.Partition)
+		}
+	}
+
+	// No change
+	err = pp.Verify(100)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v, %v", changes, err)
+	}
+
+	// Partition count decreased: pin of "a" is invalidated
+	partitionCnt = 2
+	err = pp.Verify(100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(changes) != 1 || changes[0].OldCount != 4 || changes[0].NewCount != 2 ||
+		len(changes[0].Invalidated) != 1 || changes[0].Invalidated[0].Partition != 3 {
+		t.Errorf("Unexpected partition count changes %v", changes)
+	}
+
+	if _, pinned := pp.Partition(topic, []byte("a")); pinned {
+		t.Errorf("Expected invalidated pin to be removed")
+	}
+	if partition, pinned := pp.Partition(topic, []byte("b")); !pinned || partition != 1 {
+		t.Errorf("Expected key b to remain pinned to partition 1")
+	}
+
+	pp.Unpin(topic, []byte("b"))
+	if _, pinned := pp.Partition(topic, []byte("b")); pinned {
+		t.Errorf("Expected key b to be unpinned")
+	}
+}
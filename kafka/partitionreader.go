@@ -0,0 +1,173 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"io"
+)
+
+// PartitionReader provides file-like, ordered, access to a single
+// topic partition, starting at a given offset.
+//
+// ReadMessage() returns the partition's messages in offset order and
+// io.EOF when the end of the partition has been reached.
+// Reading may be resumed after io.EOF, in which case ReadMessage()
+// waits for new messages to be appended to the partition (`tail -f`).
+//
+// PartitionReader also implements io.Reader over the concatenated
+// message values of the partition.
+//
+// A PartitionReader is not safe for concurrent use.
+type PartitionReader struct {
+	consumer *Consumer
+	// poll polls the consumer, replaceable for testing
+	poll      func(timeoutMs int) Event
+	topic     string
+	partition int32
+	// offset of the next message to read
+	offset Offset
+	// remainder of the current message value for Read()
+	buf []byte
+}
+
+// NewPartitionReader creates a new PartitionReader for the given topic
+// and partition, starting at offset (which may be a logical offset
+// such as OffsetBeginning or OffsetTail(n)).
+//
+// conf must contain at least `bootstrap.servers`, the reader uses its
+// own Consumer instance which does not join a consumer group
+// or commit offsets.
+func NewPartitionReader(conf *ConfigMap, topic string, partition int32, offset Offset) (*PartitionReader, error) {
+	confCopy := conf.clone()
+	groupID, _ := confCopy.get("group.id", nil)
+	if groupID == nil {
+		// Required by NewConsumer() but unused since the
+		// reader assigns its partition manually.
+		confCopy.SetKey("group.id", "go-partition-reader")
+	}
+	confCopy.SetKey("enable.auto.commit", false)
+	confCopy.SetKey("enable.partition.eof", true)
+	confCopy.SetKey("go.events.channel.enable", false)
+
+	c, err := NewConsumer(&confCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &PartitionReader{consumer: c, poll: c.Poll, topic: topic, partition: partition}
+
+	err = r.Seek(offset)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Seek repositions the reader to offset, discarding any partially
+// read message value.
+func (r *PartitionReader) Seek(offset Offset) error {
+	// Re-assigning the partition is used rather than Consumer.Seek()
+	// since the latter requires the partition to be actively fetched.
+	err := r.consumer.Assign([]TopicPartition{{Topic: &r.topic, Partition: r.partition, Offset: offset}})
+	if err != nil {
+		return err
+	}
+
+	r.offset = offset
+	r.buf = nil
+
+	return nil
+}
+
+// Offset returns the offset of the next message to read, or the logical
+// offset the reader was positioned at if no message has been read since.
+func (r *PartitionReader) Offset() Offset {
+	return r.offset
+}
+
+// ReadMessage returns the next message of the partition.
+//
+// Returns io.EOF when the end of the partition is reached,
+// ctx.Err() if ctx is done before a message is available,
+// a fatal client error, or a partition error such as
+// ErrUnknownTopicOrPart if the topic or partition does not exist.
+// Other non-fatal client errors, such as transient broker connection
+// failures, are retried by the client and not returned.
+func (r *PartitionReader) ReadMessage(ctx context.Context) (*Message, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		ev := r.poll(100)
+
+		switch e := ev.(type) {
+		case *Message:
+			if e.TopicPartition.Error != nil {
+				return e, e.TopicPartition.Error
+			}
+			r.offset = e.TopicPartition.Offset + 1
+			return e, nil
+		case PartitionEOF:
+			return nil, io.EOF
+		case Error:
+			if e.IsFatal() || isPartitionError(e) {
+				return nil, e
+			}
+		default:
+			// Ignore other event types
+		}
+	}
+}
+
+// isPartitionError returns true if err is a non-retriable error of
+// the reader's topic or partition, rather than of the client.
+func isPartitionError(err Error) bool {
+	switch err.Code() {
+	case ErrUnknownPartition, ErrUnknownTopicOrPart, ErrUnknownTopic:
+		return true
+	}
+	return false
+}
+
+// Read implements io.Reader by reading the partition's message values
+// as a contiguous byte stream.
+// Returns io.EOF when the end of the partition is reached.
+func (r *PartitionReader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		msg, err := r.ReadMessage(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		r.buf = msg.Value
+	}
+
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// Close closes the reader and its underlying Consumer instance.
+func (r *PartitionReader) Close() error {
+	return r.consumer.Close()
+}
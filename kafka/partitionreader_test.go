@@ -0,0 +1,93 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestPartitionReaderAPIs dry-tests the PartitionReader APIs, no broker is needed.
+func TestPartitionReaderAPIs(t *testing.T) {
+	r, err := NewPartitionReader(&ConfigMap{"socket.timeout.ms": 10},
+		"gotest", 0, OffsetBeginning)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if r.Offset() != OffsetBeginning {
+		t.Errorf("Expected offset %v, not %v", OffsetBeginning, r.Offset())
+	}
+
+	err = r.Seek(Offset(42))
+	if err != nil {
+		t.Errorf("Seek failed: %s", err)
+	}
+	if r.Offset() != Offset(42) {
+		t.Errorf("Expected offset 42, not %v", r.Offset())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	msg, err := r.ReadMessage(ctx)
+	t.Logf("ReadMessage() returned %v and error %v", msg, err)
+	// Broker connection errors are not fatal, the read times out
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected ReadMessage() to time out without a broker, not %v", err)
+	}
+
+	err = r.Close()
+	if err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+}
+
+// TestPartitionReaderPartitionErrors tests that errors of the reader's
+// topic or partition are returned while others are retried,
+// no broker is needed.
+func TestPartitionReaderPartitionErrors(t *testing.T) {
+	r, err := NewPartitionReader(&ConfigMap{"socket.timeout.ms": 10},
+		"gotest", 50, OffsetBeginning)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer r.Close()
+
+	for _, code := range []ErrorCode{ErrUnknownPartition, ErrUnknownTopicOrPart, ErrUnknownTopic} {
+		events := []Event{
+			newErrorFromString(ErrTransport, "Broker transport failure"),
+			newErrorFromString(code, "gotest [50]"),
+		}
+		r.poll = func(timeoutMs int) Event {
+			ev := events[0]
+			events = events[1:]
+			return ev
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err = r.ReadMessage(ctx)
+		cancel()
+		if kerr, ok := err.(Error); !ok || kerr.Code() != code {
+			t.Errorf("Expected %v error, got %v", code, err)
+		}
+		if len(events) != 0 {
+			t.Errorf("Expected %v error to be returned after the transport error", code)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GuardAction is the action a ProcessingGuard takes when a message handler
+// is about to exceed the consumer's `max.poll.interval.ms`.
+type GuardAction int
+
+const (
+	// GuardPauseAndPoll pauses the assigned partitions and keeps polling
+	// the consumer until the handler returns, after which the partitions
+	// are resumed.
+	GuardPauseAndPoll = GuardAction(iota)
+	// GuardCancel cancels the handler's context and waits for the
+	// handler to return.
+	GuardCancel
+)
+
+// String returns the human-readable representation of a GuardAction
+func (a GuardAction) String() string {
+	switch a {
+	case GuardPauseAndPoll:
+		return "PauseAndPoll"
+	case GuardCancel:
+		return "Cancel"
+	default:
+		return fmt.Sprintf("Unknown%d?", int(a))
+	}
+}
+
+// MessageHandler processes a consumed message.
+// Long-running handlers should honour ctx cancellation.
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+// ProcessingGuard prevents a consumer from being silently ejected from its
+// consumer group when message processing takes longer than the configured
+// `max.poll.interval.ms`.
+//
+// Messages are processed through Process() which runs the handler
+// and, once the handler has been running for longer than the guard's
+// threshold, performs the configured GuardAction.
+//
+// Events polled by the guard while the partitions are paused are
+// retained and returned by the guard's Poll() method, which the
+// application must use instead of Consumer.Poll().
+// The guard requires a Poll()-based Consumer, i.e.,
+// `go.events.channel.enable` must not be set.
+type ProcessingGuard struct {
+	consumer  *Consumer
+	action    GuardAction
+	threshold time.Duration
+	pending   []Event
+}
+
+// NewProcessingGuard creates a new ProcessingGuard for consumer c.
+//
+// maxPollInterval must match the consumer's `max.poll.interval.ms`
+// configuration (librdkafka default: 300000ms if 0 is passed).
+// The guard action is performed when a handler has been running for
+// half of maxPollInterval, leaving ample time for the action to take effect.
+func NewProcessingGuard(c *Consumer, maxPollInterval time.Duration, action GuardAction) (*ProcessingGuard, error) {
+	if c == nil {
+		return nil, newErrorFromString(ErrInvalidArg, "Consumer must not be nil")
+	}
+
+	if action != GuardPauseAndPoll && action != GuardCancel {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid GuardAction %v", action))
+	}
+
+	if maxPollInterval == 0 {
+		maxPollInterval = 300000 * time.Millisecond
+	}
+
+	return &ProcessingGuard{
+		consumer:  c,
+		action:    action,
+		threshold: maxPollInterval / 2,
+	}, nil
+}
+
+// Poll returns events retained while partitions were paused, if any,
+// else polls the consumer.
+// See Consumer.Poll()
+func (g *ProcessingGuard) Poll(timeoutMs int) (event Event) {
+	if len(g.pending) > 0 {
+		event = g.pending[0]
+		g.pending = g.pending[1:]
+		return event
+	}
+
+	return g.consumer.Poll(timeoutMs)
+}
+
+// Process runs handler for msg, performing the guard action if
+// the handler has not returned within the guard threshold.
+//
+// Returns the handler's error.
+func (g *ProcessingGuard) Process(ctx context.Context, msg *Message, handler MessageHandler) error {
+	handlerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	doneChan := make(chan error, 1)
+	go func() {
+		doneChan <- handler(handlerCtx, msg)
+	}()
+
+	timer := time.NewTimer(g.threshold)
+	defer timer.Stop()
+
+	select {
+	case err := <-doneChan:
+		return err
+	case <-timer.C:
+	}
+
+	if g.action == GuardCancel {
+		cancel()
+		return <-doneChan
+	}
+
+	return g.pauseAndPoll(doneChan)
+}
+
+// pauseAndPoll pauses the current assignment and polls the consumer
+// until the handler signals completion on doneChan, then resumes the
+// paused partitions.
+func (g *ProcessingGuard) pauseAndPoll(doneChan chan error) error {
+	paused, err := g.consumer.Assignment()
+	if err == nil && len(paused) > 0 {
+		err = g.consumer.Pause(paused)
+	}
+	// Could not pause, keep polling regardless to stay in the group:
+	// the polled events are retained for the application.
+	pausing := err == nil
+	if !pausing {
+		paused = nil
+	}
+
+	for {
+		select {
+		case err = <-doneChan:
+			if len(paused) > 0 {
+				// Partitions revoked by a rebalance while paused
+				// are no longer assigned, the resulting error is
+				// irrelevant.
+				g.consumer.Resume(paused)
+			}
+			return err
+
+		default:
+			ev := g.consumer.Poll(100)
+			if ev != nil {
+				g.pending = append(g.pending, ev)
+			}
+			if pausing {
+				paused = g.repause(paused)
+			}
+		}
+	}
+}
+
+// repause follows assignment changes by rebalances while paused:
+// newly assigned partitions are paused, and retained messages of
+// revoked partitions are dropped.
+// Returns the paused partitions that are still assigned.
+func (g *ProcessingGuard) repause(paused []TopicPartition) []TopicPartition {
+	assignment, err := g.consumer.Assignment()
+	if err != nil {
+		return paused
+	}
+
+	key := func(tp TopicPartition) string {
+		return fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition)
+	}
+
+	wasPaused := make(map[string]bool)
+	for _, tp := range paused {
+		wasPaused[key(tp)] = true
+	}
+	assigned := make(map[string]bool)
+	var added []TopicPartition
+	for _, tp := range assignment {
+		assigned[key(tp)] = true
+		if !wasPaused[key(tp)] {
+			added = append(added, tp)
+		}
+	}
+
+	if len(added) > 0 && g.consumer.Pause(added) != nil {
+		added = nil
+	}
+
+	if len(added) == 0 && len(assignment) == len(paused) {
+		return paused
+	}
+
+	var pending []Event
+	for _, ev := range g.pending {
+		if msg, ok := ev.(*Message); ok && msg.TopicPartition.Topic != nil &&
+			!assigned[key(msg.TopicPartition)] {
+			continue
+		}
+		pending = append(pending, ev)
+	}
+	g.pending = pending
+
+	var stillPaused []TopicPartition
+	for _, tp := range paused {
+		if assigned[key(tp)] {
+			stillPaused = append(stillPaused, tp)
+		}
+	}
+
+	return append(stillPaused, added...)
+}
@@ -0,0 +1,121 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestProcessingGuard tests both guard actions on long-running handlers, no broker is needed.
+func TestProcessingGuard(t *testing.T) {
+	c, err := NewConsumer(&ConfigMap{
+		"group.id":          "gotest",
+		"socket.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer c.Close()
+
+	_, err = NewProcessingGuard(c, 0, GuardAction(99))
+	if err == nil {
+		t.Fatalf("Expected NewProcessingGuard() to fail with invalid action")
+	}
+
+	topic := "gotest"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic}}
+
+	// GuardCancel: handler is cancelled once the threshold is reached
+	g, err := NewProcessingGuard(c, 200*time.Millisecond, GuardCancel)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	start := time.Now()
+	err = g.Process(context.Background(), msg, func(ctx context.Context, m *Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected handler to be cancelled, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected handler to be cancelled after ~100ms, not %v", time.Since(start))
+	}
+
+	// GuardPauseAndPoll: handler runs to completion
+	g, err = NewProcessingGuard(c, 200*time.Millisecond, GuardPauseAndPoll)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	err = g.Process(context.Background(), msg, func(ctx context.Context, m *Message) error {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		t.Errorf("Expected handler to complete, got %v", err)
+	}
+}
+
+// TestProcessingGuardRebalance tests that partitions assigned while paused
+// are paused, and that retained messages of revoked partitions are dropped,
+// no broker is needed.
+func TestProcessingGuardRebalance(t *testing.T) {
+	c, err := NewConsumer(&ConfigMap{
+		"group.id":          "gotest",
+		"socket.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer c.Close()
+
+	g, err := NewProcessingGuard(c, 0, GuardPauseAndPoll)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	revoked := TopicPartition{Topic: &topic, Partition: 0}
+	assigned := TopicPartition{Topic: &topic, Partition: 1}
+
+	// Partition 0 was paused and has since been replaced by partition 1
+	err = c.Assign([]TopicPartition{assigned})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	g.pending = []Event{
+		&Message{TopicPartition: revoked},
+		&Message{TopicPartition: assigned},
+	}
+
+	paused := g.repause([]TopicPartition{revoked})
+
+	if len(paused) != 1 || paused[0].Partition != 1 {
+		t.Errorf("Expected partition 1 to be paused, got %v", paused)
+	}
+
+	if len(g.pending) != 1 || g.pending[0].(*Message).TopicPartition.Partition != 1 {
+		t.Errorf("Expected only partition 1's message to be retained, got %v", g.pending)
+	}
+}
@@ -0,0 +1,70 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+// ProduceInterceptor intercepts messages before they are produced,
+// e.g., to add headers or to set their key or partition.
+// See Producer.AddProduceInterceptor()
+type ProduceInterceptor interface {
+	// OnProduce is called with each message before it is produced and
+	// may modify it. Returning an error fails producing the message
+	// with that error.
+	OnProduce(msg *Message) error
+}
+
+// ProduceInterceptorFunc adapts an ordinary function to the
+// ProduceInterceptor interface.
+type ProduceInterceptorFunc func(msg *Message) error
+
+// OnProduce calls f(msg)
+func (f ProduceInterceptorFunc) OnProduce(msg *Message) error {
+	return f(msg)
+}
+
+// AddProduceInterceptor adds interceptor to the interceptors called with
+// each message subsequently produced, by any of the Produce*() methods or
+// ProduceChannel(), in the order they were added.
+//
+// Interceptors are called from the producing goroutine, which for
+// ProduceChannel() is the Producer's internal channel producer. A message
+// failed by an interceptor is not produced: the error is returned by the
+// Produce*() method, or, for ProduceChannel(), set as the message's
+// TopicPartition.Error and the message emitted on the Events() channel.
+func (p *Producer) AddProduceInterceptor(interceptor ProduceInterceptor) {
+	p.interceptorsLock.Lock()
+	defer p.interceptorsLock.Unlock()
+
+	// Copy-on-write, intercept() reads the interceptors without locking
+	current, _ := p.interceptors.Load().([]ProduceInterceptor)
+	interceptors := make([]ProduceInterceptor, len(current), len(current)+1)
+	copy(interceptors, current)
+	p.interceptors.Store(append(interceptors, interceptor))
+}
+
+// intercept calls the produce interceptors with msg,
+// returning the first error.
+func (p *Producer) intercept(msg *Message) error {
+	interceptors, _ := p.interceptors.Load().([]ProduceInterceptor)
+	for _, interceptor := range interceptors {
+		err := interceptor.OnProduce(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestProduceInterceptors tests that interceptors are called, in order,
+// by all produce methods, no broker is needed.
+func TestProduceInterceptors(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	ki, err := NewKeyGeneratorInterceptor(KeyGeneratorFunc(func(msg *Message) ([]byte, error) {
+		return []byte("generated"), nil
+	}))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	intercepted := make(chan *Message, 10)
+
+	p.AddProduceInterceptor(ProduceInterceptorFunc(func(msg *Message) error {
+		if string(msg.Value) == "reject" {
+			return newErrorFromString(ErrInvalidArg, "Rejected")
+		}
+		return nil
+	}))
+	p.AddProduceInterceptor(ki)
+	p.AddProduceInterceptor(NewChecksumInterceptor())
+	p.AddProduceInterceptor(ProduceInterceptorFunc(func(msg *Message) error {
+		// The checksum covers the generated key
+		if VerifyChecksum(msg) != nil || string(msg.Key) != "generated" {
+			t.Errorf("Expected interceptors to be called in order: %v", msg)
+		}
+		intercepted <- msg
+		return nil
+	}))
+
+	topic := "gotest"
+	newMsg := func(value string) *Message {
+		return &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny},
+			Value: []byte(value)}
+	}
+
+	err = p.Produce(newMsg("produce"), nil)
+	if err != nil {
+		t.Errorf("Produce failed: %s", err)
+	}
+
+	err = p.ProduceWithCallback(newMsg("callback"), func(*Message) {})
+	if err != nil {
+		t.Errorf("ProduceWithCallback failed: %s", err)
+	}
+
+	// Fails on message timeout without a broker, after interception
+	p.ProduceSync(context.Background(), newMsg("sync"))
+
+	p.ProduceChannel() <- newMsg("channel")
+
+	for _, expected := range []string{"produce", "callback", "sync", "channel"} {
+		select {
+		case msg := <-intercepted:
+			if string(msg.Value) != expected {
+				t.Errorf("Expected %s message to be intercepted, got %v", expected, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %s message to be intercepted", expected)
+		}
+	}
+
+	err = p.Produce(newMsg("reject"), nil)
+	if err == nil || err.(Error).Code() != ErrInvalidArg {
+		t.Errorf("Expected rejected message to fail with ErrInvalidArg, got %v", err)
+	}
+
+	p.ProduceChannel() <- newMsg("reject")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-p.Events():
+			msg, ok := ev.(*Message)
+			if !ok || string(msg.Value) != "reject" {
+				continue
+			}
+			if msg.TopicPartition.Error == nil ||
+				msg.TopicPartition.Error.(Error).Code() != ErrInvalidArg {
+				t.Errorf("Expected rejected channel message to fail with ErrInvalidArg, got %v",
+					msg.TopicPartition.Error)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("Expected rejected channel message on Events()")
+		}
+	}
+}
@@ -17,8 +17,11 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -135,6 +138,16 @@ type Producer struct {
 
 	// Terminates the poller() goroutine
 	pollerTermChan chan bool
+
+	// Set to 1 by the first call to Close()
+	isClosed int32
+
+	// *ProduceTracer set by SetProduceTracer()
+	tracer atomic.Value
+
+	// []ProduceInterceptor added by AddProduceInterceptor()
+	interceptors     atomic.Value
+	interceptorsLock sync.Mutex
 }
 
 // String returns a human readable name for a Producer instance
@@ -147,11 +160,16 @@ func (p *Producer) gethandle() *handle {
 	return &p.handle
 }
 
-func (p *Producer) produce(msg *Message, msgFlags int, deliveryChan chan Event) error {
+func (p *Producer) produce(msg *Message, msgFlags int, deliveryChan chan Event, deliveryCb func(*Message)) error {
 	if msg == nil || msg.TopicPartition.Topic == nil || len(*msg.TopicPartition.Topic) == 0 {
 		return newErrorFromString(ErrInvalidArg, "")
 	}
 
+	err := p.intercept(msg)
+	if err != nil {
+		return err
+	}
+
 	crkt := p.handle.getRkt(*msg.TopicPartition.Topic)
 
 	// Three problems:
@@ -205,14 +223,22 @@ func (p *Producer) produce(msg *Message, msgFlags int, deliveryChan chan Event)
 
 	var cgoid int
 
+	var trace *produceTrace
+	if tracer, _ := p.tracer.Load().(*ProduceTracer); tracer != nil {
+		trace = tracer.sample(msg)
+	}
+
 	// Per-message state that needs to be retained through the C code:
-	//   delivery channel (if specified)
-	//   message opaque   (if specified)
+	//   delivery channel  (if specified)
+	//   delivery callback (if specified)
+	//   message opaque    (if specified)
+	//   message trace     (if sampled)
 	// Since these cant be passed as opaque pointers to the C code,
 	// due to cgo constraints, we add them to a per-producer map for lookup
 	// when the C code triggers the callbacks or events.
-	if deliveryChan != nil || msg.Opaque != nil {
-		cgoid = p.handle.cgoPut(cgoDr{deliveryChan: deliveryChan, opaque: msg.Opaque})
+	if deliveryChan != nil || deliveryCb != nil || msg.Opaque != nil || trace != nil {
+		cgoid = p.handle.cgoPut(cgoDr{deliveryChan: deliveryChan, deliveryCb: deliveryCb,
+			opaque: msg.Opaque, trace: trace})
 	}
 
 	var timestamp int64
@@ -252,6 +278,10 @@ func (p *Producer) produce(msg *Message, msgFlags int, deliveryChan chan Event)
 		tmphdrs = []C.tmphdr_t{{nil, nil, 0}}
 	}
 
+	if trace != nil {
+		trace.enqueued()
+	}
+
 	cErr := C.do_produce(p.handle.rk, crkt,
 		C.int32_t(msg.TopicPartition.Partition),
 		C.int(msgFlags)|C.RD_KAFKA_MSG_F_COPY,
@@ -264,7 +294,11 @@ func (p *Producer) produce(msg *Message, msgFlags int, deliveryChan chan Event)
 		if cgoid != 0 {
 			p.handle.cgoGet(cgoid)
 		}
-		return newError(cErr)
+		err = newError(cErr)
+		if trace != nil {
+			trace.enqueueFailed(err)
+		}
+		return err
 	}
 
 	return nil
@@ -279,9 +313,54 @@ func (p *Producer) produce(msg *Message, msgFlags int, deliveryChan chan Event)
 // api.version.request=true, and broker >= 0.10.0.0.
 // msg.Headers requires librdkafka >= 0.11.4 (else returns ErrNotImplemented),
 // api.version.request=true, and broker >= 0.11.0.0.
+// The message's Key, Value and Headers are copied before Produce returns,
+// after which the application may reuse their buffers.
 // Returns an error if message could not be enqueued.
 func (p *Producer) Produce(msg *Message, deliveryChan chan Event) error {
-	return p.produce(msg, 0, deliveryChan)
+	return p.produce(msg, 0, deliveryChan, nil)
+}
+
+// ProduceWithCallback produces a single message, like Produce(), but
+// calls deliveryCb with the message's delivery report instead of
+// sending it on a channel.
+// Check the delivery report's TopicPartition.Error for delivery failure.
+//
+// deliveryCb is called from the goroutine serving delivery reports,
+// the Producer's internal poller or the application's Poll() call,
+// and must not block.
+// Returns an error if message could not be enqueued, in which case
+// deliveryCb is not called.
+func (p *Producer) ProduceWithCallback(msg *Message, deliveryCb func(*Message)) error {
+	if deliveryCb == nil {
+		return newErrorFromString(ErrInvalidArg, "deliveryCb must not be nil")
+	}
+	return p.produce(msg, 0, nil, deliveryCb)
+}
+
+// ProduceSync produces a single message and waits for its delivery report,
+// returning the partition and offset the message was delivered to.
+//
+// Returns the message's delivery error, or ctx.Err() if ctx is done
+// before the delivery report is received, in which case the message
+// may still be delivered.
+func (p *Producer) ProduceSync(ctx context.Context, msg *Message) (*TopicPartition, error) {
+	deliveryChan := make(chan Event, 1)
+
+	err := p.produce(msg, 0, deliveryChan, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case ev := <-deliveryChan:
+		m := ev.(*Message)
+		if m.TopicPartition.Error != nil {
+			return nil, m.TopicPartition.Error
+		}
+		return &m.TopicPartition, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 // Produce a batch of messages.
@@ -305,12 +384,23 @@ func (p *Producer) produceBatch(topic string, msgs []*Message, msgFlags int) err
 	return nil
 }
 
+// SetProduceTracer enables tracing of a sample of the messages subsequently
+// produced with tracer, or disables tracing if tracer is nil.
+// See ProduceTracer
+func (p *Producer) SetProduceTracer(tracer *ProduceTracer) {
+	p.tracer.Store(tracer)
+}
+
 // Events returns the Events channel (read)
 func (p *Producer) Events() chan Event {
 	return p.events
 }
 
 // ProduceChannel returns the produce *Message channel (write)
+//
+// The Key, Value and Headers of messages sent on the channel must not be
+// modified until the message's delivery report has been received,
+// see Message.Copy().
 func (p *Producer) ProduceChannel() chan *Message {
 	return p.produceChannel
 }
@@ -346,7 +436,22 @@ func (p *Producer) Flush(timeoutMs int) int {
 
 // Close a Producer instance.
 // The Producer object or its channels are no longer usable after this call.
+// Close is safe to call multiple times and from multiple goroutines,
+// only the first call, or a CloseContext() call, closes the instance.
+//
+// Outstanding messages are not flushed, see CloseContext().
 func (p *Producer) Close() {
+	if !atomic.CompareAndSwapInt32(&p.isClosed, 0, 1) {
+		// Already closed, or being closed by CloseContext()
+		return
+	}
+
+	p.close()
+}
+
+// close closes the Producer instance, once claimed by Close() or
+// CloseContext()
+func (p *Producer) close() {
 	// Wait for poller() (signaled by closing pollerTermChan)
 	// and channel_producer() (signaled by closing ProduceChannel)
 	close(p.pollerTermChan)
@@ -360,6 +465,47 @@ func (p *Producer) Close() {
 	C.rd_kafka_destroy(p.handle.rk)
 }
 
+// CloseContext flushes outstanding messages until all messages have been
+// delivered (or permanently failed) or ctx is done, whichever happens first,
+// and then closes the Producer instance.
+//
+// The returned CloseReport provides the number of messages flushed and
+// the number of messages dropped, in which case ctx.Err() is also returned.
+//
+// The instance is considered closed as soon as CloseContext is called:
+// concurrent Close() calls return immediately and concurrent
+// CloseContext() calls return an ErrState error.
+// See Close()
+func (p *Producer) CloseContext(ctx context.Context) (report CloseReport, err error) {
+	if !atomic.CompareAndSwapInt32(&p.isClosed, 0, 1) {
+		return report, newErrorFromString(ErrState, "Producer already closed")
+	}
+
+	outstanding := p.Len()
+
+	for p.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		default:
+			p.Flush(100)
+			continue
+		}
+		break
+	}
+
+	report.MessagesDropped = p.Len()
+	report.MessagesFlushed = outstanding - report.MessagesDropped
+	if report.MessagesFlushed < 0 {
+		// More messages were produced while closing
+		report.MessagesFlushed = 0
+	}
+
+	p.close()
+
+	return report, err
+}
+
 // NewProducer creates a new high-level Producer instance.
 //
 // conf is a *ConfigMap with standard librdkafka configuration properties, see here:
@@ -471,7 +617,7 @@ func NewProducer(conf *ConfigMap) (*Producer, error) {
 func channelProducer(p *Producer) {
 
 	for m := range p.produceChannel {
-		err := p.produce(m, C.RD_KAFKA_MSG_F_BLOCK, nil)
+		err := p.produce(m, C.RD_KAFKA_MSG_F_BLOCK, nil, nil)
 		if err != nil {
 			m.TopicPartition.Error = err
 			p.events <- m
@@ -491,6 +637,12 @@ func channelBatchProducer(p *Producer) {
 	totBatchCnt := 0
 
 	for m := range p.produceChannel {
+		err := p.intercept(m)
+		if err != nil {
+			m.TopicPartition.Error = err
+			p.events <- m
+			continue
+		}
 		buffered[*m.TopicPartition.Topic] = append(buffered[*m.TopicPartition.Topic], m)
 		bufferedCnt++
 
@@ -507,6 +659,12 @@ func channelBatchProducer(p *Producer) {
 				if m.TopicPartition.Topic == nil {
 					panic(fmt.Sprintf("message without Topic received on ProduceChannel: %v", m))
 				}
+				err := p.intercept(m)
+				if err != nil {
+					m.TopicPartition.Error = err
+					p.events <- m
+					continue
+				}
 				buffered[*m.TopicPartition.Topic] = append(buffered[*m.TopicPartition.Topic], m)
 				bufferedCnt++
 				if bufferedCnt >= batchSize {
@@ -17,6 +17,7 @@
 package kafka
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"reflect"
@@ -227,3 +228,228 @@ func TestProducerInvalidConfig(t *testing.T) {
 		t.Fatalf("Expected NewProducer() to fail with delivery.report.only.error set")
 	}
 }
+
+// TestProducerCloseContext verifies CloseContext() reporting and repeated Close() calls.
+func TestProducerCloseContext(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 60000})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	for i := 0; i < 3; i++ {
+		err = p.Produce(&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}}, nil)
+		if err != nil {
+			t.Fatalf("Produce failed: %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	report, err := p.CloseContext(ctx)
+	t.Logf("CloseContext() returned %v and error %v", report, err)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected CloseContext() to time out, not %v", err)
+	}
+	if report.MessagesDropped < 3 {
+		t.Errorf("Expected at least 3 dropped messages, not %d", report.MessagesDropped)
+	}
+
+	// Already closed
+	p.Close()
+	_, err = p.CloseContext(context.Background())
+	if err == nil || err.(Error).Code() != ErrState {
+		t.Errorf("Expected ErrState from CloseContext() on closed producer, not %v", err)
+	}
+}
+
+// TestProducerCloseContextConcurrent verifies that a Close() call
+// concurrent with CloseContext() leaves the closing to CloseContext().
+func TestProducerCloseContextConcurrent(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 60000})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	err = p.Produce(&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}}, nil)
+	if err != nil {
+		t.Fatalf("Produce failed: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	closedChan := make(chan bool)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		p.Close()
+		close(closedChan)
+	}()
+
+	_, err = p.CloseContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected CloseContext() to time out, not %v", err)
+	}
+
+	select {
+	case <-closedChan:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected concurrent Close() to return")
+	}
+}
+
+// TestProducerTrace tests that sampled messages are traced through
+// to their delivery report, no broker is needed.
+func TestProducerTrace(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	traceChan := make(chan ProduceTraceEvent, 10)
+	tracer, err := NewProduceTracer(1.0, nil, func(ev ProduceTraceEvent) {
+		traceChan <- ev
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	p.SetProduceTracer(tracer)
+
+	drChan := make(chan Event, 1)
+	topic := "gotest"
+	err = p.Produce(&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0},
+		Value: []byte("traced")}, drChan)
+	if err != nil {
+		t.Fatalf("Produce failed: %s", err)
+	}
+
+	ev := <-traceChan
+	if ev.Stage != TraceEnqueued {
+		t.Errorf("Expected %v trace event, got %v", TraceEnqueued, ev)
+	}
+
+	<-drChan
+
+	ev = <-traceChan
+	t.Logf("Delivery trace event: %v", ev)
+	if ev.Stage != TraceDeliveryFailed || ev.Error == nil {
+		t.Errorf("Expected %v trace event, got %v", TraceDeliveryFailed, ev)
+	}
+
+	// Exceeds message.max.bytes: fails to enqueue, after being traced
+	err = p.Produce(&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0},
+		Value: make([]byte, 2000000)}, drChan)
+	if err == nil {
+		t.Fatalf("Expected Produce of oversized message to fail")
+	}
+
+	for _, stage := range []ProduceTraceStage{TraceEnqueued, TraceEnqueueFailed} {
+		ev = <-traceChan
+		if ev.Stage != stage {
+			t.Errorf("Expected %v trace event, got %v", stage, ev)
+		}
+	}
+
+	// Disable tracing
+	p.SetProduceTracer(nil)
+	err = p.Produce(&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}}, nil)
+	if err != nil {
+		t.Fatalf("Produce failed: %s", err)
+	}
+	p.Flush(1000)
+
+	if len(traceChan) > 0 {
+		t.Errorf("Expected no trace events with tracing disabled, got %v", <-traceChan)
+	}
+}
+
+// TestProducerDeliveryCallback tests per-message delivery callbacks,
+// no broker is needed.
+func TestProducerDeliveryCallback(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	topic := "gotest"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0},
+		Value: []byte("callback"), Opaque: "opaque"}
+
+	err = p.ProduceWithCallback(msg, nil)
+	if err == nil || err.(Error).Code() != ErrInvalidArg {
+		t.Errorf("Expected ErrInvalidArg for nil callback, not %v", err)
+	}
+
+	drChan := make(chan *Message, 1)
+	err = p.ProduceWithCallback(msg, func(m *Message) {
+		drChan <- m
+	})
+	if err != nil {
+		t.Fatalf("ProduceWithCallback failed: %s", err)
+	}
+
+	select {
+	case m := <-drChan:
+		if m.TopicPartition.Error == nil {
+			t.Errorf("Expected delivery failure without broker, got %v", m)
+		}
+		if m.Opaque != "opaque" {
+			t.Errorf("Expected opaque to be retained, got %v", m.Opaque)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Delivery callback not called")
+	}
+
+	select {
+	case ev := <-p.Events():
+		t.Errorf("Expected no delivery report on Events(), got %v", ev)
+	default:
+	}
+}
+
+// TestProducerProduceSync tests ProduceSync() failures, no broker is needed.
+func TestProducerProduceSync(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	topic := "gotest"
+	tp, err := p.ProduceSync(context.Background(),
+		&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}})
+	if err == nil || tp != nil {
+		t.Errorf("Expected delivery failure without broker, got %v, %v", tp, err)
+	}
+
+	p2, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 60000})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	tp, err = p2.ProduceSync(ctx,
+		&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v, %v", tp, err)
+	}
+}
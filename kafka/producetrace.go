@@ -0,0 +1,214 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// ProduceTraceStage is a stage in the lifecycle of a traced message.
+type ProduceTraceStage int
+
+const (
+	// TraceEnqueued - the message is being enqueued on the producer's
+	// internal transmit queue. Traced before enqueuing, so that it
+	// precedes the message's delivery stage.
+	TraceEnqueued = ProduceTraceStage(iota)
+	// TraceEnqueueFailed - the message could not be enqueued,
+	// Produce() returned an error. Follows TraceEnqueued.
+	TraceEnqueueFailed
+	// TraceDelivered - the message was acknowledged by the partition
+	// leader and its delivery report was emitted.
+	TraceDelivered
+	// TraceDeliveryFailed - the message permanently failed delivery
+	// and its delivery report was emitted.
+	TraceDeliveryFailed
+)
+
+// String returns the human-readable representation of a ProduceTraceStage
+func (s ProduceTraceStage) String() string {
+	switch s {
+	case TraceEnqueued:
+		return "Enqueued"
+	case TraceEnqueueFailed:
+		return "EnqueueFailed"
+	case TraceDelivered:
+		return "Delivered"
+	case TraceDeliveryFailed:
+		return "DeliveryFailed"
+	default:
+		return fmt.Sprintf("Unknown%d?", int(s))
+	}
+}
+
+// ProduceTraceEvent describes a lifecycle stage of a traced message.
+type ProduceTraceEvent struct {
+	// ID identifies the traced message across its trace events.
+	ID uint64
+	// Stage is the lifecycle stage reached.
+	Stage ProduceTraceStage
+	// Message is the redacted copy of the traced message.
+	// For the delivery stages TopicPartition is the delivery report's
+	// partition, offset and error.
+	Message *Message
+	// Elapsed is the time since the message was produced.
+	Elapsed time.Duration
+	// Error is the enqueue or delivery error, if any.
+	Error error
+}
+
+// String returns a human-readable representation of a ProduceTraceEvent.
+func (ev ProduceTraceEvent) String() string {
+	s := fmt.Sprintf("ProduceTrace #%d %v after %v: %v key=%q value=%q headers=%v",
+		ev.ID, ev.Stage, ev.Elapsed, ev.Message.TopicPartition,
+		ev.Message.Key, ev.Message.Value, ev.Message.Headers)
+	if ev.Error != nil {
+		s += fmt.Sprintf(": %v", ev.Error)
+	}
+	return s
+}
+
+// RedactPayload is the default ProduceTracer redactor: it returns a copy
+// of msg where the key, value and header values are replaced by their
+// sizes so that no payload is logged.
+func RedactPayload(msg *Message) *Message {
+	redact := func(b []byte) []byte {
+		if b == nil {
+			return nil
+		}
+		return []byte(fmt.Sprintf("<%d bytes>", len(b)))
+	}
+
+	redacted := &Message{
+		TopicPartition: msg.TopicPartition,
+		Key:            redact(msg.Key),
+		Value:          redact(msg.Value),
+		Timestamp:      msg.Timestamp,
+		TimestampType:  msg.TimestampType,
+	}
+
+	for _, hdr := range msg.Headers {
+		redacted.Headers = append(redacted.Headers,
+			Header{Key: hdr.Key, Value: redact(hdr.Value)})
+	}
+
+	return redacted
+}
+
+// ProduceTracer traces the lifecycle of a sample of produced messages,
+// from Produce() to the delivery report, to diagnose lost or slow messages
+// without enabling librdkafka's global `debug` logging.
+//
+// librdkafka does not expose the batching and broker transmission of
+// individual messages: these are reflected by the delivery stage's
+// partition, offset and elapsed time.
+//
+// Enable tracing on a Producer with Producer.SetProduceTracer().
+type ProduceTracer struct {
+	// Accessed atomically, keep first for 64-bit alignment.
+	nextID     uint64
+	sampleRate float64
+	redact     func(msg *Message) *Message
+	logger     func(ev ProduceTraceEvent)
+}
+
+// NewProduceTracer creates a new ProduceTracer tracing a random sampleRate
+// (0 < sampleRate <= 1.0) fraction of the produced messages.
+//
+// redact returns the copy of a message to include in trace events,
+// it defaults to RedactPayload if nil.
+// logger is called, from the producing or delivery report goroutine, for each
+// trace event, it defaults to logging with the standard log package if nil.
+func NewProduceTracer(sampleRate float64, redact func(msg *Message) *Message, logger func(ev ProduceTraceEvent)) (*ProduceTracer, error) {
+	if sampleRate <= 0.0 || sampleRate > 1.0 {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid trace sample rate %v, must be > 0 and <= 1.0", sampleRate))
+	}
+
+	if redact == nil {
+		redact = RedactPayload
+	}
+
+	if logger == nil {
+		logger = func(ev ProduceTraceEvent) {
+			log.Print(ev)
+		}
+	}
+
+	return &ProduceTracer{sampleRate: sampleRate, redact: redact, logger: logger}, nil
+}
+
+// produceTrace is the per-message trace state, retained
+// in the message's cgoDr until the delivery report.
+type produceTrace struct {
+	tracer *ProduceTracer
+	id     uint64
+	start  time.Time
+	msg    *Message
+}
+
+// sample returns a new produceTrace for msg if it is sampled, else nil.
+func (t *ProduceTracer) sample(msg *Message) *produceTrace {
+	if t.sampleRate < 1.0 && rand.Float64() >= t.sampleRate {
+		return nil
+	}
+
+	return &produceTrace{
+		tracer: t,
+		id:     atomic.AddUint64(&t.nextID, 1),
+		start:  time.Now(),
+		msg:    t.redact(msg),
+	}
+}
+
+// emit logs a trace event for stage
+func (tr *produceTrace) emit(stage ProduceTraceStage, msg *Message, err error) {
+	tr.tracer.logger(ProduceTraceEvent{
+		ID:      tr.id,
+		Stage:   stage,
+		Message: msg,
+		Elapsed: time.Since(tr.start),
+		Error:   err,
+	})
+}
+
+// enqueued traces that the message is being enqueued, before it is
+// handed to librdkafka which may emit its delivery report at any time.
+func (tr *produceTrace) enqueued() {
+	tr.emit(TraceEnqueued, tr.msg, nil)
+}
+
+// enqueueFailed traces that the message could not be enqueued.
+func (tr *produceTrace) enqueueFailed(err error) {
+	tr.emit(TraceEnqueueFailed, tr.msg, err)
+}
+
+// delivered traces the delivery report dr of the message.
+func (tr *produceTrace) delivered(dr *Message) {
+	msg := *tr.msg
+	msg.TopicPartition = dr.TopicPartition
+
+	if dr.TopicPartition.Error != nil {
+		tr.emit(TraceDeliveryFailed, &msg, dr.TopicPartition.Error)
+	} else {
+		tr.emit(TraceDelivered, &msg, nil)
+	}
+}
@@ -0,0 +1,107 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRedactPayload tests the default trace redactor
+func TestRedactPayload(t *testing.T) {
+	topic := "traced"
+	msg := &Message{
+		TopicPartition: TopicPartition{Topic: &topic, Partition: 2},
+		Key:            []byte("secret key"),
+		Headers:        []Header{{Key: "hdr", Value: []byte("secret")}},
+	}
+
+	redacted := RedactPayload(msg)
+
+	if string(redacted.Key) != "<10 bytes>" {
+		t.Errorf("Expected redacted key, got %q", redacted.Key)
+	}
+	if redacted.Value != nil {
+		t.Errorf("Expected nil value to remain nil, got %q", redacted.Value)
+	}
+	if len(redacted.Headers) != 1 || redacted.Headers[0].Key != "hdr" ||
+		string(redacted.Headers[0].Value) != "<6 bytes>" {
+		t.Errorf("Expected redacted header value, got %v", redacted.Headers)
+	}
+	if string(msg.Key) != "secret key" || string(msg.Headers[0].Value) != "secret" {
+		t.Errorf("Original message modified by redaction: %v", msg)
+	}
+}
+
+// TestProduceTracer tests trace sampling and lifecycle events
+func TestProduceTracer(t *testing.T) {
+	for _, rate := range []float64{0, -1, 1.5} {
+		_, err := NewProduceTracer(rate, nil, nil)
+		if err == nil || err.(Error).Code() != ErrInvalidArg {
+			t.Errorf("Expected ErrInvalidArg for sample rate %v, got %v", rate, err)
+		}
+	}
+
+	var events []ProduceTraceEvent
+	tracer, err := NewProduceTracer(1.0, nil, func(ev ProduceTraceEvent) {
+		events = append(events, ev)
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "traced"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny},
+		Value: []byte("payload")}
+
+	tr1 := tracer.sample(msg)
+	tr2 := tracer.sample(msg)
+	if tr1 == nil || tr2 == nil {
+		t.Fatalf("Expected all messages to be sampled")
+	}
+
+	tr1.enqueued()
+	tr1.delivered(&Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 1, Offset: 42}})
+	tr2.enqueued()
+	tr2.enqueueFailed(newErrorFromString(ErrQueueFull, "Queue full"))
+
+	expected := []ProduceTraceStage{TraceEnqueued, TraceDelivered, TraceEnqueued, TraceEnqueueFailed}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d trace events, got %d: %v", len(expected), len(events), events)
+	}
+
+	for i, stage := range expected {
+		if events[i].Stage != stage {
+			t.Errorf("Trace event #%d: expected stage %v, got %v", i, stage, events[i].Stage)
+		}
+		if strings.Contains(events[i].String(), "payload") {
+			t.Errorf("Trace event #%d not redacted: %v", i, events[i])
+		}
+	}
+
+	if events[0].ID != events[1].ID || events[2].ID != events[3].ID || events[0].ID == events[2].ID {
+		t.Errorf("Expected trace ids to identify messages: %v", events)
+	}
+
+	if events[1].Message.TopicPartition.Partition != 1 || events[1].Message.TopicPartition.Offset != 42 {
+		t.Errorf("Expected delivery report partition and offset, got %v", events[1].Message.TopicPartition)
+	}
+
+	if events[2].Error != nil || events[3].Error == nil {
+		t.Errorf("Expected enqueue error in enqueue failed trace event only")
+	}
+}
@@ -0,0 +1,341 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry topic message headers, set on messages produced to retry topics
+// and the dead letter topic by RetryTopicManager.
+const (
+	// RetryHeaderAttempt is the number of failed processing attempts.
+	RetryHeaderAttempt = "retry-attempt"
+	// RetryHeaderOriginalTopic is the topic the message was first consumed from.
+	RetryHeaderOriginalTopic = "retry-original-topic"
+	// RetryHeaderOriginalPartition is the partition the message was first
+	// consumed from.
+	RetryHeaderOriginalPartition = "retry-original-partition"
+	// RetryHeaderOriginalOffset is the offset the message was first
+	// consumed at.
+	RetryHeaderOriginalOffset = "retry-original-offset"
+	// RetryHeaderDue is the time, in milliseconds since the epoch, at which
+	// the message is due for re-processing.
+	RetryHeaderDue = "retry-due"
+	// RetryHeaderError is the error of the last failed processing attempt.
+	RetryHeaderError = "retry-error"
+)
+
+// ExponentialRetryDelays returns attempts retry delays starting at initial
+// and multiplied by multiplier for each subsequent attempt, capped at max
+// (if max is non-zero).
+func ExponentialRetryDelays(initial time.Duration, multiplier float64, attempts int, max time.Duration) []time.Duration {
+	delays := make([]time.Duration, attempts)
+	delay := float64(initial)
+	for i := range delays {
+		delays[i] = time.Duration(delay)
+		if max > 0 && delays[i] > max {
+			delays[i] = max
+		}
+		delay *= multiplier
+	}
+	return delays
+}
+
+// RetryTopicConfig configures the retry topics of a RetryTopicManager.
+type RetryTopicConfig struct {
+	// Topic is the main topic.
+	Topic string
+	// Delays are the re-processing delays of the successive retry
+	// attempts, one retry topic is used per distinct delay.
+	Delays []time.Duration
+	// DeadLetterTopic receives messages that failed all retry attempts,
+	// it defaults to "<Topic>-dlt".
+	DeadLetterTopic string
+}
+
+// RetryTopicManager implements non-blocking retries with retry topics:
+// messages that fail processing are produced to a retry topic for their
+// attempt, with the attempt's delay, and, once all attempts have failed,
+// to a dead letter topic, so that failing messages do not block
+// the processing of the main topic.
+//
+// The application consumes the main topic and the retry topics, see
+// Topics(), and checks with Ready() that a message is due for processing
+// before processing it.
+// Not yet due retry topic partitions are paused until their next message
+// is due, and resumed by ResumeDue() which must be called regularly from
+// the consume loop.
+//
+// RetryTopicManager is safe for concurrent use.
+type RetryTopicManager struct {
+	config  RetryTopicConfig
+	produce func(msg *Message, deliveryChan chan Event) error
+
+	lock sync.Mutex
+	// paused partitions: "topic\x00partition" -> due time
+	paused map[string]pausedRetryPartition
+}
+
+// pausedRetryPartition is a retry topic partition paused until due
+type pausedRetryPartition struct {
+	tp  TopicPartition
+	due time.Time
+}
+
+// NewRetryTopicManager creates a new RetryTopicManager producing failed
+// messages with producer p.
+func NewRetryTopicManager(p *Producer, config RetryTopicConfig) (*RetryTopicManager, error) {
+	if p == nil {
+		return nil, newErrorFromString(ErrInvalidArg, "Producer must not be nil")
+	}
+	if config.Topic == "" {
+		return nil, newErrorFromString(ErrInvalidArg, "Topic must be set")
+	}
+	for _, delay := range config.Delays {
+		if delay < 0 {
+			return nil, newErrorFromString(ErrInvalidArg,
+				fmt.Sprintf("Invalid negative retry delay %v", delay))
+		}
+	}
+	if config.DeadLetterTopic == "" {
+		config.DeadLetterTopic = config.Topic + "-dlt"
+	}
+
+	return &RetryTopicManager{
+		config:  config,
+		produce: p.Produce,
+		paused:  make(map[string]pausedRetryPartition),
+	}, nil
+}
+
+// RetryTopic returns the retry topic of the given retry attempt (1..),
+// named "<Topic>-retry-<delay in ms>", or the dead letter topic if attempt
+// exceeds the configured number of retries.
+func (m *RetryTopicManager) RetryTopic(attempt int) string {
+	if attempt < 1 || attempt > len(m.config.Delays) {
+		return m.config.DeadLetterTopic
+	}
+	return fmt.Sprintf("%s-retry-%d", m.config.Topic,
+		m.config.Delays[attempt-1]/time.Millisecond)
+}
+
+// retryTopics returns the distinct retry topics
+func (m *RetryTopicManager) retryTopics() []string {
+	var topics []string
+	seen := make(map[string]bool)
+	for attempt := 1; attempt <= len(m.config.Delays); attempt++ {
+		topic := m.RetryTopic(attempt)
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// Topics returns the main topic and the retry topics, which are to be
+// consumed by the application.
+func (m *RetryTopicManager) Topics() []string {
+	return append([]string{m.config.Topic}, m.retryTopics()...)
+}
+
+// CreateTopics creates the retry topics and the dead letter topic,
+// topics that already exist are left unmodified.
+func (m *RetryTopicManager) CreateTopics(ctx context.Context, a *AdminClient, numPartitions int, replicationFactor int) error {
+	var specs []TopicSpecification
+	for _, topic := range append(m.retryTopics(), m.config.DeadLetterTopic) {
+		specs = append(specs, TopicSpecification{
+			Topic:             topic,
+			NumPartitions:     numPartitions,
+			ReplicationFactor: replicationFactor,
+		})
+	}
+
+	results, err := a.CreateTopics(ctx, specs)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Error.Code() != ErrNoError &&
+			result.Error.Code() != ErrTopicAlreadyExists {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+// headerValue returns the value of the last header named key, if any.
+func headerValue(msg *Message, key string) (string, bool) {
+	for i := len(msg.Headers) - 1; i >= 0; i-- {
+		if msg.Headers[i].Key == key {
+			return string(msg.Headers[i].Value), true
+		}
+	}
+	return "", false
+}
+
+// RetryAttempt returns the number of failed processing attempts of msg,
+// 0 for messages from the main topic.
+func RetryAttempt(msg *Message) int {
+	v, found := headerValue(msg, RetryHeaderAttempt)
+	if !found {
+		return 0
+	}
+	attempt, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+// Fail produces msg, whose processing failed with cause, to the retry topic
+// of its next attempt, or to the dead letter topic once all attempts have
+// failed.
+// The delivery report is sent on deliveryChan, see Producer.Produce().
+func (m *RetryTopicManager) Fail(msg *Message, cause error, deliveryChan chan Event) error {
+	attempt := RetryAttempt(msg) + 1
+	topic := m.RetryTopic(attempt)
+
+	var headers []Header
+	for _, hdr := range msg.Headers {
+		switch hdr.Key {
+		case RetryHeaderAttempt, RetryHeaderDue, RetryHeaderError:
+			// Replaced below
+		default:
+			headers = append(headers, hdr)
+		}
+	}
+
+	if _, found := headerValue(msg, RetryHeaderOriginalTopic); !found &&
+		msg.TopicPartition.Topic != nil {
+		headers = append(headers,
+			Header{Key: RetryHeaderOriginalTopic, Value: []byte(*msg.TopicPartition.Topic)},
+			Header{Key: RetryHeaderOriginalPartition,
+				Value: []byte(strconv.Itoa(int(msg.TopicPartition.Partition)))},
+			Header{Key: RetryHeaderOriginalOffset,
+				Value: []byte(strconv.FormatInt(int64(msg.TopicPartition.Offset), 10))})
+	}
+
+	headers = append(headers, Header{Key: RetryHeaderAttempt, Value: []byte(strconv.Itoa(attempt))})
+
+	if attempt <= len(m.config.Delays) {
+		due := time.Now().Add(m.config.Delays[attempt-1])
+		headers = append(headers, Header{Key: RetryHeaderDue,
+			Value: []byte(strconv.FormatInt(due.UnixNano()/int64(time.Millisecond), 10))})
+	}
+
+	if cause != nil {
+		headers = append(headers, Header{Key: RetryHeaderError, Value: []byte(cause.Error())})
+	}
+
+	return m.produce(&Message{
+		TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers:        headers,
+	}, deliveryChan)
+}
+
+// RetryDue returns the time at which msg is due for re-processing, and false
+// if msg has no due time (e.g., it was consumed from the main topic).
+func RetryDue(msg *Message) (time.Time, bool) {
+	v, found := headerValue(msg, RetryHeaderDue)
+	if !found {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// Ready returns true if msg, consumed by c, is due for processing.
+//
+// If msg is not yet due its partition is paused and rewound to msg,
+// which is consumed again once the partition is resumed by ResumeDue().
+// The application must not process, or commit the offset of, a
+// message that is not ready.
+// If rewinding fails the partition is resumed and the error returned.
+func (m *RetryTopicManager) Ready(c *Consumer, msg *Message) (bool, error) {
+	due, found := RetryDue(msg)
+	if !found || !due.After(time.Now()) {
+		return true, nil
+	}
+
+	tp := msg.TopicPartition
+	tp.Error = nil
+	tps := []TopicPartition{tp}
+
+	err := c.Pause(tps)
+	if err != nil {
+		return false, err
+	}
+
+	err = c.Seek(tp, 0)
+	if err != nil {
+		// Not tracked as paused, it would never be resumed
+		c.Resume(tps)
+		return false, err
+	}
+
+	m.lock.Lock()
+	m.paused[fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition)] = pausedRetryPartition{tp: tp, due: due}
+	m.lock.Unlock()
+
+	return false, nil
+}
+
+// ResumeDue resumes the retry topic partitions of c whose next
+// message is due.
+func (m *RetryTopicManager) ResumeDue(c *Consumer) error {
+	now := time.Now()
+
+	m.lock.Lock()
+	var due []TopicPartition
+	for key, p := range m.paused {
+		if !p.due.After(now) {
+			due = append(due, p.tp)
+			delete(m.paused, key)
+		}
+	}
+	m.lock.Unlock()
+
+	if len(due) == 0 {
+		return nil
+	}
+
+	return c.Resume(due)
+}
+
+// Forget forgets the paused state of partitions, which must be
+// called when partitions are revoked from the consumer.
+func (m *RetryTopicManager) Forget(partitions []TopicPartition) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, tp := range partitions {
+		delete(m.paused, fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition))
+	}
+}
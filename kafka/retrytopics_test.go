@@ -0,0 +1,134 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestExponentialRetryDelays tests retry delay generation
+func TestExponentialRetryDelays(t *testing.T) {
+	delays := ExponentialRetryDelays(time.Second, 10, 4, time.Minute)
+	expected := []time.Duration{time.Second, 10 * time.Second, time.Minute, time.Minute}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("Expected %v, got %v", expected, delays)
+	}
+}
+
+// TestRetryTopicManager tests retry and dead letter routing, no broker is needed.
+func TestRetryTopicManager(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{"socket.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	_, err = NewRetryTopicManager(p, RetryTopicConfig{})
+	if err == nil {
+		t.Errorf("Expected NewRetryTopicManager() without topic to fail")
+	}
+
+	m, err := NewRetryTopicManager(p, RetryTopicConfig{
+		Topic:  "orders",
+		Delays: []time.Duration{time.Second, time.Minute, time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	var produced []*Message
+	m.produce = func(msg *Message, deliveryChan chan Event) error {
+		produced = append(produced, msg)
+		return nil
+	}
+
+	expTopics := []string{"orders", "orders-retry-1000", "orders-retry-60000"}
+	if topics := m.Topics(); !reflect.DeepEqual(topics, expTopics) {
+		t.Errorf("Expected topics %v, got %v", expTopics, topics)
+	}
+
+	topic := "orders"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: 2, Offset: 42},
+		Key: []byte("k"), Value: []byte("v"), Headers: []Header{{Key: "app", Value: []byte("x")}}}
+
+	if ready, _ := m.Ready(nil, msg); !ready {
+		t.Errorf("Expected main topic message to be ready")
+	}
+
+	expRouting := []string{"orders-retry-1000", "orders-retry-60000", "orders-retry-60000", "orders-dlt"}
+	for i, expTopic := range expRouting {
+		err = m.Fail(msg, errors.New("processing failed"), nil)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+
+		retried := produced[i]
+		if *retried.TopicPartition.Topic != expTopic {
+			t.Errorf("Attempt %d: expected topic %s, got %s", i+1, expTopic, *retried.TopicPartition.Topic)
+		}
+		if RetryAttempt(retried) != i+1 {
+			t.Errorf("Attempt %d: expected attempt header %d, got %d", i+1, i+1, RetryAttempt(retried))
+		}
+
+		origTopic, _ := headerValue(retried, RetryHeaderOriginalTopic)
+		origOffset, _ := headerValue(retried, RetryHeaderOriginalOffset)
+		cause, _ := headerValue(retried, RetryHeaderError)
+		app, _ := headerValue(retried, "app")
+		if origTopic != "orders" || origOffset != "42" || cause != "processing failed" || app != "x" {
+			t.Errorf("Attempt %d: unexpected headers %v", i+1, retried.Headers)
+		}
+
+		_, hasDue := RetryDue(retried)
+		if hasDue != (expTopic != "orders-dlt") {
+			t.Errorf("Attempt %d: unexpected due header presence %v", i+1, hasDue)
+		}
+
+		// Consume from the retry topic
+		retried.TopicPartition.Partition = 0
+		retried.TopicPartition.Offset = Offset(i)
+		msg = retried
+	}
+
+	if len(produced[3].Headers) != len(produced[2].Headers)-1 {
+		t.Errorf("Expected headers to be replaced, not accumulated: %v", produced[3].Headers)
+	}
+
+	// Overdue retry is ready
+	past := &Message{Headers: []Header{{Key: RetryHeaderDue, Value: []byte("1000")}}}
+	if ready, _ := m.Ready(nil, past); !ready {
+		t.Errorf("Expected overdue message to be ready")
+	}
+
+	// Rewinding an unassigned partition fails
+	c, err := NewConsumer(&ConfigMap{"group.id": "gotest", "socket.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer c.Close()
+
+	// Retry due in a minute
+	ready, err := m.Ready(c, produced[1])
+	if ready || err == nil {
+		t.Errorf("Expected Ready() to fail rewinding an unassigned partition, got %v, %v", ready, err)
+	}
+	if len(m.paused) != 0 {
+		t.Errorf("Expected no paused partitions after failed rewind, got %v", m.paused)
+	}
+}
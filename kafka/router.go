@@ -0,0 +1,124 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Router dispatches consumed messages to handlers by a routing key,
+// such as an event type header or the value's schema id, for topics
+// carrying several types of messages.
+//
+// Messages without a handler for their key, or without a key, are
+// dispatched to the fallback handler, if any.
+//
+// Router is safe for concurrent use.
+type Router struct {
+	// keyOf returns the routing key of msg, if any
+	keyOf func(msg *Message) (string, bool)
+
+	lock     sync.RWMutex
+	handlers map[string]MessageHandler
+	fallback MessageHandler
+}
+
+// NewHeaderRouter creates a new Router routing messages by the value of
+// their first header named header, e.g., "event-type".
+func NewHeaderRouter(header string) *Router {
+	return &Router{
+		keyOf: func(msg *Message) (string, bool) {
+			for _, h := range msg.Headers {
+				if h.Key == header {
+					return string(h.Value), true
+				}
+			}
+			return "", false
+		},
+		handlers: make(map[string]MessageHandler),
+	}
+}
+
+// NewSchemaIDRouter creates a new Router routing messages by the Schema
+// Registry schema id of their Schema Registry wire format encoded value,
+// see SchemaIDOf() and HandleSchemaID().
+func NewSchemaIDRouter() *Router {
+	return &Router{
+		keyOf: func(msg *Message) (string, bool) {
+			id := SchemaIDOf(msg.Value)
+			if id == NoSchemaID {
+				return "", false
+			}
+			return strconv.Itoa(int(id)), true
+		},
+		handlers: make(map[string]MessageHandler),
+	}
+}
+
+// Handle registers handler for messages with routing key key,
+// replacing any previously registered handler.
+func (r *Router) Handle(key string, handler MessageHandler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.handlers[key] = handler
+}
+
+// HandleSchemaID registers handler for messages with schema id id,
+// for routers created with NewSchemaIDRouter().
+func (r *Router) HandleSchemaID(id int32, handler MessageHandler) {
+	r.Handle(strconv.Itoa(int(id)), handler)
+}
+
+// HandleFallback registers handler for messages without a handler for
+// their routing key, or without a routing key.
+func (r *Router) HandleFallback(handler MessageHandler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.fallback = handler
+}
+
+// Route dispatches msg to its handler and returns the handler's error.
+// An ErrNoent error is returned if msg has neither a handler nor a
+// fallback handler.
+//
+// Route is a MessageHandler, e.g., for ProcessingGuard.Process().
+func (r *Router) Route(ctx context.Context, msg *Message) error {
+	key, found := r.keyOf(msg)
+
+	r.lock.RLock()
+	handler := r.handlers[key]
+	if !found || handler == nil {
+		handler = r.fallback
+	}
+	r.lock.RUnlock()
+
+	if handler == nil {
+		if !found {
+			return newErrorFromString(ErrNoent,
+				fmt.Sprintf("No routing key and no fallback handler for message %v", msg))
+		}
+		return newErrorFromString(ErrNoent,
+			fmt.Sprintf("No handler for routing key \"%s\" of message %v", key, msg))
+	}
+
+	return handler(ctx, msg)
+}
@@ -0,0 +1,100 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"testing"
+)
+
+// TestHeaderRouter tests routing by header value, no broker is needed.
+func TestHeaderRouter(t *testing.T) {
+	var routed []string
+
+	r := NewHeaderRouter("event-type")
+	r.Handle("created", func(ctx context.Context, msg *Message) error {
+		routed = append(routed, "created")
+		return nil
+	})
+	r.Handle("deleted", func(ctx context.Context, msg *Message) error {
+		routed = append(routed, "deleted")
+		return nil
+	})
+
+	msgs := []*Message{
+		{Headers: []Header{{Key: "other", Value: []byte("deleted")}, {Key: "event-type", Value: []byte("created")}}},
+		{Headers: []Header{{Key: "event-type", Value: []byte("deleted")}}},
+		{Headers: []Header{{Key: "event-type", Value: []byte("updated")}}},
+		{},
+	}
+
+	for i, msg := range msgs {
+		err := r.Route(context.Background(), msg)
+		if i < 2 && err != nil {
+			t.Errorf("Message #%d: %s", i, err)
+		} else if i >= 2 && (err == nil || err.(Error).Code() != ErrNoent) {
+			t.Errorf("Message #%d: expected ErrNoent without fallback, got %v", i, err)
+		}
+	}
+
+	r.HandleFallback(func(ctx context.Context, msg *Message) error {
+		routed = append(routed, "fallback")
+		return nil
+	})
+
+	for i, msg := range msgs[2:] {
+		err := r.Route(context.Background(), msg)
+		if err != nil {
+			t.Errorf("Message #%d: %s", i+2, err)
+		}
+	}
+
+	expected := []string{"created", "deleted", "fallback", "fallback"}
+	if len(routed) != len(expected) {
+		t.Fatalf("Expected routes %v, got %v", expected, routed)
+	}
+	for i := range expected {
+		if routed[i] != expected[i] {
+			t.Errorf("Expected routes %v, got %v", expected, routed)
+			break
+		}
+	}
+}
+
+// TestSchemaIDRouter tests routing by schema id, no broker is needed.
+func TestSchemaIDRouter(t *testing.T) {
+	routed := 0
+
+	r := NewSchemaIDRouter()
+	r.HandleSchemaID(258, func(ctx context.Context, msg *Message) error {
+		routed++
+		return nil
+	})
+
+	err := r.Route(context.Background(), &Message{Value: []byte{0, 0, 0, 1, 2, 'x'}})
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	if routed != 1 {
+		t.Errorf("Expected schema id 258 to be routed")
+	}
+
+	err = r.Route(context.Background(), &Message{Value: []byte("plain")})
+	if err == nil {
+		t.Errorf("Expected error for value without schema id")
+	}
+}
@@ -0,0 +1,377 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package runner processes consumed messages concurrently across
+// partitions, in order within each partition.
+//
+// A Runner polls a consumer and dispatches each message to a goroutine
+// dedicated to the message's partition, so that partitions are processed
+// in parallel (bounded by Config.MaxConcurrency) while the messages of
+// each partition are processed one at a time, in offset order.
+//
+// Offsets are committed with the consumer's managed commit mode
+// (go.managed.commit.enable): only offsets up to which all messages have
+// been processed are committed, on the auto commit interval and when
+// partitions are revoked. Partitions whose workers fall behind by more
+// than Config.QueueSize messages are paused until they catch up.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Handler processes a consumed message.
+// ctx is cancelled when the Runner stops.
+type Handler func(ctx context.Context, msg *kafka.Message) error
+
+// Config configures a Runner.
+type Config struct {
+	// MaxConcurrency is the maximum number of messages processed
+	// concurrently, defaults to runtime.NumCPU().
+	MaxConcurrency int
+	// QueueSize is the number of messages queued per partition before the
+	// partition is paused, defaults to 100.
+	QueueSize int
+	// PollTimeout is the consumer poll timeout, which bounds the time to
+	// react to Run()'s ctx being done, defaults to 100ms.
+	PollTimeout time.Duration
+	// OnError, if not nil, is called when the Handler fails to process msg.
+	// Returning nil skips the message, which is committed as processed,
+	// returning an error stops the Runner.
+	// If OnError is nil Handler errors stop the Runner.
+	OnError func(msg *kafka.Message, err error) error
+}
+
+// Runner processes consumed messages with per-partition workers.
+type Runner struct {
+	consumer *kafka.Consumer
+	handler  Handler
+	config   Config
+
+	ctx context.Context
+	// concurrency semaphore
+	sem chan bool
+	// workers by partition, only accessed by Run()'s goroutine
+	workers map[string]*worker
+	// first error stopping the Runner
+	errChan chan error
+}
+
+// New creates a new Runner processing messages with handler, consuming with
+// a new consumer created from conf, which must contain at least
+// `bootstrap.servers` and `group.id`.
+//
+// The consumer's managed commit mode and auto commit are enabled, since
+// processed offsets are committed by the auto commit interval, rebalances
+// and closing, and the application's rebalancing configuration is
+// overridden.
+func New(conf *kafka.ConfigMap, handler Handler, config Config) (*Runner, error) {
+	if handler == nil {
+		return nil, kafka.NewError(kafka.ErrInvalidArg, "Handler must not be nil", false)
+	}
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = runtime.NumCPU()
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.PollTimeout <= 0 {
+		config.PollTimeout = 100 * time.Millisecond
+	}
+
+	confCopy := kafka.ConfigMap{}
+	for k, v := range *conf {
+		confCopy[k] = v
+	}
+	confCopy["go.managed.commit.enable"] = true
+	confCopy["enable.auto.commit"] = true
+	confCopy["go.application.rebalance.enable"] = false
+	confCopy["go.events.channel.enable"] = false
+
+	c, err := kafka.NewConsumer(&confCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{
+		consumer: c,
+		handler:  handler,
+		config:   config,
+		sem:      make(chan bool, config.MaxConcurrency),
+		workers:  make(map[string]*worker),
+		errChan:  make(chan error, 1),
+	}, nil
+}
+
+// Consumer returns the Runner's underlying consumer.
+func (r *Runner) Consumer() *kafka.Consumer {
+	return r.consumer
+}
+
+// Run subscribes to topics and processes messages until ctx is done,
+// which returns nil, or until processing fails, which returns the error.
+//
+// Messages being processed when Run returns are completed, but queued
+// messages are not processed and will be consumed again.
+// The consumer is closed when Run returns.
+func (r *Runner) Run(ctx context.Context, topics []string) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.ctx = ctx
+
+	defer func() {
+		r.stopAll()
+		cancel()
+		closeErr := r.consumer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	err = r.consumer.SubscribeTopics(topics, r.rebalance)
+	if err != nil {
+		return err
+	}
+
+	pollMs := int(r.config.PollTimeout / time.Millisecond)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err = <-r.errChan:
+			return err
+		default:
+		}
+
+		switch e := r.consumer.Poll(pollMs).(type) {
+		case *kafka.Message:
+			if e.TopicPartition.Error != nil {
+				continue
+			}
+			err = r.dispatch(e)
+			if err != nil {
+				return err
+			}
+		case kafka.Error:
+			if e.IsFatal() {
+				return e
+			}
+		}
+	}
+}
+
+// fail stops the Runner with err, unless it is already stopping
+func (r *Runner) fail(err error) {
+	select {
+	case r.errChan <- err:
+	default:
+	}
+}
+
+// workerKey returns the workers key of tp
+func workerKey(tp kafka.TopicPartition) string {
+	return fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition)
+}
+
+// dispatch queues msg on the worker of its partition, pausing the
+// partition if the worker's queue is full.
+func (r *Runner) dispatch(msg *kafka.Message) error {
+	key := workerKey(msg.TopicPartition)
+	w, found := r.workers[key]
+	if !found {
+		w = newWorker(r, msg.TopicPartition)
+		r.workers[key] = w
+		go w.run()
+	}
+
+	return w.enqueue(msg)
+}
+
+// rebalance implements kafka.RebalanceCb: revoked partitions' workers
+// complete their current message before the partitions are unassigned,
+// so that their processed offsets are committed.
+func (r *Runner) rebalance(c *kafka.Consumer, ev kafka.Event) error {
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		return c.Assign(e.Partitions)
+	case kafka.RevokedPartitions:
+		for _, tp := range e.Partitions {
+			key := workerKey(tp)
+			if w, found := r.workers[key]; found {
+				w.stop()
+				delete(r.workers, key)
+			}
+		}
+		return c.Unassign()
+	}
+	return nil
+}
+
+// stopAll stops all workers
+func (r *Runner) stopAll() {
+	for key, w := range r.workers {
+		w.stop()
+		delete(r.workers, key)
+	}
+}
+
+// worker processes the messages of a partition in order
+type worker struct {
+	r  *Runner
+	tp kafka.TopicPartition
+
+	lock   sync.Mutex
+	queue  []*kafka.Message
+	paused bool
+
+	wakeChan chan bool
+	termChan chan bool
+	doneChan chan bool
+}
+
+// newWorker creates a new worker for partition tp
+func newWorker(r *Runner, tp kafka.TopicPartition) *worker {
+	tp.Offset = kafka.OffsetInvalid
+	tp.Error = nil
+	return &worker{
+		r:        r,
+		tp:       tp,
+		wakeChan: make(chan bool, 1),
+		termChan: make(chan bool),
+		doneChan: make(chan bool),
+	}
+}
+
+// enqueue queues msg for processing, pausing the partition if the
+// queue is full.
+func (w *worker) enqueue(msg *kafka.Message) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.queue = append(w.queue, msg)
+
+	select {
+	case w.wakeChan <- true:
+	default:
+	}
+
+	if len(w.queue) >= w.r.config.QueueSize && !w.paused {
+		err := w.r.consumer.Pause([]kafka.TopicPartition{w.tp})
+		if err != nil {
+			return err
+		}
+		w.paused = true
+	}
+
+	return nil
+}
+
+// next dequeues the next message, if any, resuming the partition once
+// the queue is half empty.
+func (w *worker) next() (*kafka.Message, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.queue) == 0 {
+		return nil, nil
+	}
+
+	msg := w.queue[0]
+	w.queue[0] = nil
+	w.queue = w.queue[1:]
+
+	if w.paused && len(w.queue) <= w.r.config.QueueSize/2 {
+		err := w.r.consumer.Resume([]kafka.TopicPartition{w.tp})
+		if err != nil {
+			return nil, err
+		}
+		w.paused = false
+	}
+
+	return msg, nil
+}
+
+// run processes queued messages until stopped
+func (w *worker) run() {
+	defer close(w.doneChan)
+
+	for {
+		select {
+		case <-w.termChan:
+			return
+		case <-w.wakeChan:
+		}
+
+		for {
+			select {
+			case <-w.termChan:
+				return
+			default:
+			}
+
+			msg, err := w.next()
+			if err != nil {
+				w.r.fail(err)
+				return
+			}
+			if msg == nil {
+				break
+			}
+
+			err = w.process(msg)
+			if err != nil {
+				w.r.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// process processes msg and marks it processed
+func (w *worker) process(msg *kafka.Message) error {
+	select {
+	case w.r.sem <- true:
+	case <-w.termChan:
+		return nil
+	}
+
+	err := w.r.handler(w.r.ctx, msg)
+	<-w.r.sem
+
+	if err != nil {
+		if w.r.config.OnError == nil {
+			return err
+		}
+		err = w.r.config.OnError(msg, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.r.consumer.MarkProcessed(msg)
+}
+
+// stop stops the worker once its current message, if any, is processed
+func (w *worker) stop() {
+	close(w.termChan)
+	<-w.doneChan
+}
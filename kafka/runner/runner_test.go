@@ -0,0 +1,129 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// testConf is a consumer configuration that needs no broker
+var testConf = kafka.ConfigMap{
+	"group.id":          "gotest",
+	"socket.timeout.ms": 10,
+}
+
+// TestRunnerDispatch tests per-partition ordering and bounded concurrency,
+// no broker is needed.
+func TestRunnerDispatch(t *testing.T) {
+	var lock sync.Mutex
+	processed := make(map[int32][]kafka.Offset)
+	running := 0
+	maxRunning := 0
+	var wg sync.WaitGroup
+
+	handler := func(ctx context.Context, msg *kafka.Message) error {
+		defer wg.Done()
+
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		lock.Lock()
+		running--
+		tp := msg.TopicPartition
+		processed[tp.Partition] = append(processed[tp.Partition], tp.Offset)
+		lock.Unlock()
+		return nil
+	}
+
+	r, err := New(&testConf, handler, Config{MaxConcurrency: 2, QueueSize: 1000})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	r.ctx = context.Background()
+
+	topic := "gotest"
+	for offset := 0; offset < 20; offset++ {
+		for partition := int32(0); partition < 4; partition++ {
+			wg.Add(1)
+			err = r.dispatch(&kafka.Message{TopicPartition: kafka.TopicPartition{
+				Topic: &topic, Partition: partition, Offset: kafka.Offset(offset)}})
+			if err != nil {
+				t.Fatalf("dispatch failed: %s", err)
+			}
+		}
+	}
+
+	wg.Wait()
+	r.stopAll()
+	r.consumer.Close()
+
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent messages, not %d", maxRunning)
+	}
+
+	for partition, offsets := range processed {
+		if len(offsets) != 20 {
+			t.Errorf("Partition %d: expected 20 messages, not %d", partition, len(offsets))
+		}
+		for i, offset := range offsets {
+			if offset != kafka.Offset(i) {
+				t.Errorf("Partition %d: out of order offsets %v", partition, offsets)
+				break
+			}
+		}
+	}
+
+	select {
+	case err = <-r.errChan:
+		t.Errorf("Unexpected runner error: %s", err)
+	default:
+	}
+}
+
+// TestRunnerRun tests that Run returns when ctx is done, no broker is needed.
+func TestRunnerRun(t *testing.T) {
+	_, err := New(&testConf, nil, Config{})
+	if err == nil {
+		t.Errorf("Expected New() without handler to fail")
+	}
+
+	r, err := New(&testConf, func(ctx context.Context, msg *kafka.Message) error {
+		return nil
+	}, Config{PollTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = r.Run(ctx, []string{"gotest"})
+	if err != nil {
+		t.Errorf("Run() failed: %s", err)
+	}
+}
@@ -0,0 +1,279 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ScalingPolicy configures the worker count recommendations of a
+// ScalingAdvisor.
+type ScalingPolicy struct {
+	// MinWorkers is the minimum recommended worker count, defaults to 1.
+	MinWorkers int
+	// MaxWorkers is the maximum recommended worker count, defaults to
+	// the partition count: additional workers would be idle.
+	MaxWorkers int
+	// DrainTime is the time within which the current lag should be
+	// consumed, on top of keeping up with the arrival rate,
+	// defaults to 1 minute.
+	DrainTime time.Duration
+	// ScaleDownLag is the total lag at or below which the workers are
+	// considered to keep up with ease, and one worker fewer is
+	// recommended, defaults to 0: no lag at all.
+	ScaleDownLag int64
+}
+
+// ScalingRecommendation is a worker count recommendation, with the
+// metrics it is based on.
+type ScalingRecommendation struct {
+	// Workers is the recommended worker count.
+	Workers int `json:"workers"`
+	// CurrentWorkers is the worker count at the time of the recommendation.
+	CurrentWorkers int `json:"currentWorkers"`
+	// Partitions is the total partition count.
+	Partitions int `json:"partitions"`
+	// Lag is the total number of messages not yet committed.
+	Lag int64 `json:"lag"`
+	// ArrivalRate is the number of messages produced per second.
+	ArrivalRate float64 `json:"arrivalRate"`
+	// ProcessingRate is the number of messages committed per second.
+	ProcessingRate float64 `json:"processingRate"`
+	// Reason is a human-readable explanation of the recommendation.
+	Reason string `json:"reason"`
+}
+
+// String returns a human-readable representation of a ScalingRecommendation.
+func (r ScalingRecommendation) String() string {
+	return fmt.Sprintf("%d workers (currently %d): %s", r.Workers, r.CurrentWorkers, r.Reason)
+}
+
+// recommend returns the recommended worker count for the metrics of r,
+// whose rates are only known if sampled.
+func (p ScalingPolicy) recommend(r ScalingRecommendation, sampled bool) ScalingRecommendation {
+	maxWorkers := p.MaxWorkers
+	if maxWorkers <= 0 || (r.Partitions > 0 && maxWorkers > r.Partitions) {
+		maxWorkers = r.Partitions
+	}
+	if maxWorkers < p.MinWorkers {
+		maxWorkers = p.MinWorkers
+	}
+
+	clamp := func(workers int) int {
+		if workers > maxWorkers {
+			workers = maxWorkers
+		}
+		if workers < p.MinWorkers {
+			workers = p.MinWorkers
+		}
+		return workers
+	}
+
+	// Rate required to keep up with arrivals and drain the lag in time
+	required := r.ArrivalRate + float64(r.Lag)/p.DrainTime.Seconds()
+
+	switch {
+	case !sampled:
+		r.Workers = clamp(r.CurrentWorkers)
+		r.Reason = "rates not yet measured"
+
+	case r.Lag <= p.ScaleDownLag:
+		// The workers' spare capacity can't be measured, scale down
+		// one at a time, scaling up again if the lag grows.
+		r.Workers = clamp(r.CurrentWorkers - 1)
+		r.Reason = fmt.Sprintf("lag %d at or below %d", r.Lag, p.ScaleDownLag)
+
+	case r.CurrentWorkers <= 0 || r.ProcessingRate <= 0:
+		// No processing progress, the workers' capacity is unknown
+		r.Workers = clamp(r.CurrentWorkers + 1)
+		r.Reason = fmt.Sprintf("lag %d without processing progress", r.Lag)
+
+	case required > r.ProcessingRate:
+		// With a lag the workers are busy, so the processing rate
+		// is their capacity.
+		perWorker := r.ProcessingRate / float64(r.CurrentWorkers)
+		r.Workers = clamp(int(math.Ceil(required / perWorker)))
+		r.Reason = fmt.Sprintf("required rate %.1f msgs/s exceeds processing rate %.1f msgs/s",
+			required, r.ProcessingRate)
+
+	default:
+		r.Workers = clamp(r.CurrentWorkers)
+		r.Reason = fmt.Sprintf("lag %d drained within %v", r.Lag, p.DrainTime)
+	}
+
+	return r
+}
+
+// scalingOffsets are the end and committed offsets of a partition
+type scalingOffsets struct {
+	end       Offset
+	committed Offset
+}
+
+// scalingSample is a snapshot of a group's offsets
+type scalingSample struct {
+	at time.Time
+	// offsets by topic and partition
+	offsets map[string]scalingOffsets
+}
+
+// ScalingAdvisor recommends the number of workers (e.g., consumer
+// instances) of a consumer group from the group's lag, the rate at which
+// messages are produced and the rate at which the group commits them,
+// measured between successive updates.
+//
+// The recommendation can be served to external autoscalers, such as
+// KEDA's metrics-api scaler, with the scalinghttp subpackage.
+//
+// ScalingAdvisor is safe for concurrent use.
+type ScalingAdvisor struct {
+	policy ScalingPolicy
+
+	lock           sync.Mutex
+	last           *scalingSample
+	recommendation ScalingRecommendation
+}
+
+// NewScalingAdvisor creates a new ScalingAdvisor with the given policy.
+func NewScalingAdvisor(policy ScalingPolicy) (*ScalingAdvisor, error) {
+	if policy.MinWorkers <= 0 {
+		policy.MinWorkers = 1
+	}
+	if policy.MaxWorkers > 0 && policy.MaxWorkers < policy.MinWorkers {
+		return nil, newErrorFromString(ErrInvalidArg, "MaxWorkers must not be less than MinWorkers")
+	}
+	if policy.DrainTime <= 0 {
+		policy.DrainTime = time.Minute
+	}
+
+	return &ScalingAdvisor{policy: policy}, nil
+}
+
+// Update updates the recommendation from the group's committed offsets
+// and the end (high watermark) offsets of the same partitions, and the
+// current number of workers.
+// Partitions without a committed offset are not counted as lag.
+func (a *ScalingAdvisor) Update(committed []TopicPartition, endOffsets []TopicPartition, workers int) ScalingRecommendation {
+	return a.updateAt(time.Now(), committed, endOffsets, workers)
+}
+
+// updateAt implements Update() at the given time
+func (a *ScalingAdvisor) updateAt(now time.Time, committed []TopicPartition, endOffsets []TopicPartition, workers int) ScalingRecommendation {
+	commits := make(map[string]Offset)
+	for _, tp := range committed {
+		if tp.Topic != nil && tp.Offset >= 0 {
+			commits[fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition)] = tp.Offset
+		}
+	}
+
+	sample := &scalingSample{at: now, offsets: make(map[string]scalingOffsets)}
+	r := ScalingRecommendation{CurrentWorkers: workers, Partitions: len(endOffsets)}
+
+	for _, tp := range endOffsets {
+		if tp.Topic == nil || tp.Offset < 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s\x00%d", *tp.Topic, tp.Partition)
+		commit, found := commits[key]
+		if !found {
+			continue
+		}
+		sample.offsets[key] = scalingOffsets{end: tp.Offset, committed: commit}
+		if tp.Offset > commit {
+			r.Lag += int64(tp.Offset - commit)
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	sampled := false
+	if a.last != nil {
+		elapsed := now.Sub(a.last.at).Seconds()
+		if elapsed > 0 {
+			// Only partitions in both samples, e.g., not partitions
+			// whose first commit is in this sample, are measured.
+			var produced, processed int64
+			for key, cur := range sample.offsets {
+				prev, found := a.last.offsets[key]
+				if !found {
+					continue
+				}
+				produced += int64(cur.end - prev.end)
+				processed += int64(cur.committed - prev.committed)
+			}
+			r.ArrivalRate = math.Max(0, float64(produced)/elapsed)
+			r.ProcessingRate = math.Max(0, float64(processed)/elapsed)
+			sampled = true
+		}
+	}
+	a.last = sample
+
+	a.recommendation = a.policy.recommend(r, sampled)
+	return a.recommendation
+}
+
+// UpdateFromConsumer updates the recommendation for the group of c
+// consuming topics, querying the group's committed offsets and the
+// partitions' end offsets.
+// c does not need to be subscribed: any consumer configured with the
+// group's group.id may be used.
+func (a *ScalingAdvisor) UpdateFromConsumer(c *Consumer, topics []string, workers int, timeoutMs int) (ScalingRecommendation, error) {
+	var partitions []TopicPartition
+	for _, topic := range topics {
+		topic := topic
+		md, err := c.GetMetadata(&topic, false, timeoutMs)
+		if err != nil {
+			return ScalingRecommendation{}, err
+		}
+		tmd, found := md.Topics[topic]
+		if !found || tmd.Error.Code() != ErrNoError {
+			return ScalingRecommendation{}, newErrorFromString(ErrUnknownTopic,
+				fmt.Sprintf("Topic %s not found", topic))
+		}
+		for _, p := range tmd.Partitions {
+			partitions = append(partitions, TopicPartition{Topic: &topic, Partition: p.ID})
+		}
+	}
+
+	committed, err := c.Committed(partitions, timeoutMs)
+	if err != nil {
+		return ScalingRecommendation{}, err
+	}
+
+	endOffsets := make([]TopicPartition, len(partitions))
+	for i, tp := range partitions {
+		_, high, err := c.QueryWatermarkOffsets(*tp.Topic, tp.Partition, timeoutMs)
+		if err != nil {
+			return ScalingRecommendation{}, err
+		}
+		tp.Offset = Offset(high)
+		endOffsets[i] = tp
+	}
+
+	return a.Update(committed, endOffsets, workers), nil
+}
+
+// Recommendation returns the latest recommendation.
+func (a *ScalingAdvisor) Recommendation() ScalingRecommendation {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.recommendation
+}
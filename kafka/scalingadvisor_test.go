@@ -0,0 +1,110 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+// TestScalingAdvisor tests worker count recommendations from offset samples
+func TestScalingAdvisor(t *testing.T) {
+	_, err := NewScalingAdvisor(ScalingPolicy{MinWorkers: 4, MaxWorkers: 2})
+	if err == nil {
+		t.Errorf("Expected MaxWorkers < MinWorkers to fail")
+	}
+
+	a, err := NewScalingAdvisor(ScalingPolicy{DrainTime: 10 * time.Second, ScaleDownLag: 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	offsets := func(offsets ...int64) []TopicPartition {
+		tps := make([]TopicPartition, len(offsets))
+		for i, offset := range offsets {
+			tps[i] = TopicPartition{Topic: &topic, Partition: int32(i), Offset: Offset(offset)}
+		}
+		return tps
+	}
+
+	now := time.Now()
+	expect := func(r ScalingRecommendation, workers int) {
+		t.Logf("Recommendation: %v", r)
+		if r.Workers != workers {
+			t.Errorf("Expected %d workers, not %v", workers, r)
+		}
+	}
+
+	// First sample: rates unknown
+	r := a.updateAt(now, offsets(0, 0, 0, 0), offsets(1000, 1000, 1000, 1000), 1)
+	expect(r, 1)
+	if r.Lag != 4000 || r.Partitions != 4 {
+		t.Errorf("Unexpected lag or partitions: %v", r)
+	}
+
+	// 1 worker processing 100 msgs/s, 200 msgs/s arriving, lag 5000:
+	// 200 + 5000/10 = 700 msgs/s required, capped at 4 partitions.
+	now = now.Add(10 * time.Second)
+	r = a.updateAt(now, offsets(250, 250, 250, 250), offsets(1500, 1500, 1500, 1500), 1)
+	if r.ArrivalRate != 200 || r.ProcessingRate != 100 || r.Lag != 5000 {
+		t.Errorf("Unexpected rates or lag: %+v", r)
+	}
+	expect(r, 4)
+
+	// 4 workers processing 500 msgs/s, 100 msgs/s arriving, lag 1000:
+	// 100 + 1000/10 = 200 msgs/s required.
+	now = now.Add(10 * time.Second)
+	expect(a.updateAt(now, offsets(1500, 1500, 1500, 1500), offsets(1750, 1750, 1750, 1750), 4), 4)
+
+	// Lag within ScaleDownLag
+	now = now.Add(10 * time.Second)
+	expect(a.updateAt(now, offsets(2000, 2000, 2000, 2000), offsets(2000, 2000, 2000, 2000), 4), 3)
+
+	// No processing progress
+	now = now.Add(10 * time.Second)
+	expect(a.updateAt(now, offsets(2000, 2000, 2000, 2000), offsets(2100, 2100, 2100, 2100), 3), 4)
+}
+
+// TestScalingAdvisorFirstCommit tests that a partition's first commit
+// between samples does not count as produced or processed messages.
+func TestScalingAdvisorFirstCommit(t *testing.T) {
+	a, err := NewScalingAdvisor(ScalingPolicy{})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	tp := func(partition int32, offset int64) TopicPartition {
+		return TopicPartition{Topic: &topic, Partition: partition, Offset: Offset(offset)}
+	}
+
+	now := time.Now()
+	a.updateAt(now,
+		[]TopicPartition{tp(0, 100), tp(1, int64(OffsetInvalid))},
+		[]TopicPartition{tp(0, 110), tp(1, 100000)}, 1)
+
+	// Partition 1 is committed for the first time
+	now = now.Add(10 * time.Second)
+	r := a.updateAt(now,
+		[]TopicPartition{tp(0, 105), tp(1, 100000)},
+		[]TopicPartition{tp(0, 120), tp(1, 100000)}, 1)
+
+	if r.ArrivalRate != 1 || r.ProcessingRate != 0.5 {
+		t.Errorf("Expected arrival rate 1 and processing rate 0.5, got %+v", r)
+	}
+}
@@ -0,0 +1,60 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package scalinghttp serves a kafka.ScalingAdvisor's worker count
+// recommendations over HTTP to external autoscalers, such as KEDA's
+// metrics-api scaler.
+//
+//	advisor, err := kafka.NewScalingAdvisor(kafka.ScalingPolicy{})
+//	if err != nil {
+//	    // ...
+//	}
+//	http.Handle("/scaling", scalinghttp.NewHandler(advisor))
+//
+// The advisor is updated by the application, e.g., periodically with
+// ScalingAdvisor.UpdateFromConsumer().
+package scalinghttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// handler serves the latest recommendation of advisor
+type handler struct {
+	advisor *kafka.ScalingAdvisor
+}
+
+// NewHandler returns an http.Handler serving the latest recommendation of
+// advisor as a JSON object, e.g., for KEDA's metrics-api scaler with
+// `valueLocation: workers`.
+func NewHandler(advisor *kafka.ScalingAdvisor) http.Handler {
+	return handler{advisor: advisor}
+}
+
+// ServeHTTP implements http.Handler
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(h.advisor.Recommendation())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,55 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scalinghttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// TestHandler tests serving the latest recommendation, no broker is needed.
+func TestHandler(t *testing.T) {
+	advisor, err := kafka.NewScalingAdvisor(kafka.ScalingPolicy{})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "gotest"
+	advisor.Update(
+		[]kafka.TopicPartition{{Topic: &topic, Partition: 0, Offset: 10}},
+		[]kafka.TopicPartition{{Topic: &topic, Partition: 0, Offset: 100}},
+		1)
+
+	rec := httptest.NewRecorder()
+	NewHandler(advisor).ServeHTTP(rec, httptest.NewRequest("GET", "/scaling", nil))
+
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	var served kafka.ScalingRecommendation
+	err = json.Unmarshal(rec.Body.Bytes(), &served)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %s", rec.Body.String(), err)
+	}
+	if served != advisor.Recommendation() || served.Lag != 90 {
+		t.Errorf("Served %v, expected %v", served, advisor.Recommendation())
+	}
+}
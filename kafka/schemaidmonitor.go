@@ -0,0 +1,216 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NoSchemaID is the schema id of message values that are not in the
+// Schema Registry wire format (magic byte 0 followed by a 4-byte schema id),
+// e.g., produced by clients bypassing the registry.
+const NoSchemaID = int32(-1)
+
+// SchemaIDOf returns the Schema Registry schema id of the wire format
+// encoded value, or NoSchemaID if value is not in the wire format.
+func SchemaIDOf(value []byte) int32 {
+	if len(value) < 5 || value[0] != 0 {
+		return NoSchemaID
+	}
+
+	id := int32(binary.BigEndian.Uint32(value[1:5]))
+	if id < 0 {
+		return NoSchemaID
+	}
+
+	return id
+}
+
+// SchemaIDStats is the observed usage of a schema id on a topic.
+type SchemaIDStats struct {
+	SchemaID  int32
+	Count     int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// SchemaIDChange is emitted by a SchemaIDMonitor when a schema id
+// appears on, or disappears from, a topic.
+type SchemaIDChange struct {
+	Topic    string
+	SchemaID int32
+	// Appeared is true if the schema id was seen for the first time
+	// (or again after having disappeared), false if it disappeared.
+	Appeared bool
+	// Stats is the schema id's usage at the time of the change.
+	Stats SchemaIDStats
+}
+
+// String returns a human-readable representation of a SchemaIDChange.
+func (c SchemaIDChange) String() string {
+	what := "disappeared from"
+	if c.Appeared {
+		what = "appeared on"
+	}
+	return fmt.Sprintf("Schema id %d %s topic %s (%d messages)",
+		c.SchemaID, what, c.Topic, c.Stats.Count)
+}
+
+// SchemaIDMonitor tracks the distribution of Schema Registry schema ids
+// of consumed message values per topic, e.g., to detect producers
+// bypassing the topic's data contract.
+//
+// Messages are passed to Observe(), typically from the consume loop.
+// A schema id disappears when it has not been seen on its topic for the
+// monitor's window, which is checked by Observe() for the message's topic
+// and by Sweep() for all topics.
+//
+// SchemaIDMonitor is safe for concurrent use.
+type SchemaIDMonitor struct {
+	lock     sync.Mutex
+	window   time.Duration
+	onChange func(change SchemaIDChange)
+	topics   map[string]map[int32]*SchemaIDStats
+}
+
+// NewSchemaIDMonitor creates a new SchemaIDMonitor considering schema ids
+// not seen for window as disappeared.
+// onChange, if not nil, is called for each appearance or disappearance
+// from the goroutine calling Observe() or Sweep().
+func NewSchemaIDMonitor(window time.Duration, onChange func(change SchemaIDChange)) (*SchemaIDMonitor, error) {
+	if window <= 0 {
+		return nil, newErrorFromString(ErrInvalidArg, "Window must be positive")
+	}
+
+	return &SchemaIDMonitor{
+		window:   window,
+		onChange: onChange,
+		topics:   make(map[string]map[int32]*SchemaIDStats),
+	}, nil
+}
+
+// Observe records the schema id of msg's value.
+func (m *SchemaIDMonitor) Observe(msg *Message) {
+	if msg.TopicPartition.Topic == nil {
+		return
+	}
+
+	m.observeAt(*msg.TopicPartition.Topic, SchemaIDOf(msg.Value), time.Now())
+}
+
+// observeAt records schemaID on topic at time now
+func (m *SchemaIDMonitor) observeAt(topic string, schemaID int32, now time.Time) {
+	m.lock.Lock()
+
+	ids, found := m.topics[topic]
+	if !found {
+		ids = make(map[int32]*SchemaIDStats)
+		m.topics[topic] = ids
+	}
+
+	changes := m.expire(topic, ids, now)
+
+	stats, found := ids[schemaID]
+	if !found {
+		stats = &SchemaIDStats{SchemaID: schemaID, FirstSeen: now}
+		ids[schemaID] = stats
+	}
+	stats.Count++
+	stats.LastSeen = now
+
+	if !found {
+		changes = append(changes, SchemaIDChange{Topic: topic, SchemaID: schemaID,
+			Appeared: true, Stats: *stats})
+	}
+
+	m.lock.Unlock()
+
+	m.emit(changes)
+}
+
+// Sweep checks all topics for disappeared schema ids.
+func (m *SchemaIDMonitor) Sweep() {
+	m.sweepAt(time.Now())
+}
+
+// sweepAt checks all topics for schema ids disappeared at time now
+func (m *SchemaIDMonitor) sweepAt(now time.Time) {
+	m.lock.Lock()
+
+	var changes []SchemaIDChange
+	for topic, ids := range m.topics {
+		changes = append(changes, m.expire(topic, ids, now)...)
+	}
+
+	m.lock.Unlock()
+
+	m.emit(changes)
+}
+
+// expire removes the schema ids of topic not seen within the window
+// and returns the resulting changes.
+// Must be called with the lock held.
+func (m *SchemaIDMonitor) expire(topic string, ids map[int32]*SchemaIDStats, now time.Time) (changes []SchemaIDChange) {
+	for id, stats := range ids {
+		if now.Sub(stats.LastSeen) > m.window {
+			delete(ids, id)
+			changes = append(changes, SchemaIDChange{Topic: topic, SchemaID: id,
+				Appeared: false, Stats: *stats})
+		}
+	}
+
+	return changes
+}
+
+// emit calls the onChange callback for each change.
+// Must be called without the lock held.
+func (m *SchemaIDMonitor) emit(changes []SchemaIDChange) {
+	if m.onChange == nil {
+		return
+	}
+
+	for _, change := range changes {
+		m.onChange(change)
+	}
+}
+
+// SchemaIDs returns the current schema id distribution of topic,
+// sorted by schema id.
+func (m *SchemaIDMonitor) SchemaIDs(topic string) []SchemaIDStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stats := make([]SchemaIDStats, 0, len(m.topics[topic]))
+	for _, s := range m.topics[topic] {
+		stats = append(stats, *s)
+	}
+
+	sort.Sort(schemaIDStatsByID(stats))
+
+	return stats
+}
+
+// schemaIDStatsByID sorts SchemaIDStats by schema id
+type schemaIDStatsByID []SchemaIDStats
+
+func (s schemaIDStatsByID) Len() int           { return len(s) }
+func (s schemaIDStatsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s schemaIDStatsByID) Less(i, j int) bool { return s[i].SchemaID < s[j].SchemaID }
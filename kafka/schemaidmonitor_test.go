@@ -0,0 +1,110 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSchemaIDOf tests wire format schema id parsing
+func TestSchemaIDOf(t *testing.T) {
+	for _, tc := range []struct {
+		value    []byte
+		expected int32
+	}{
+		{[]byte{0, 0, 0, 1, 2, 'x'}, 258},
+		{[]byte{0, 0, 0, 0, 7}, 7},
+		{[]byte{0, 0, 0, 7}, NoSchemaID},
+		{[]byte{1, 0, 0, 0, 7}, NoSchemaID},
+		{[]byte{0, 0xff, 0xff, 0xff, 0xff}, NoSchemaID},
+		{[]byte(`{"json": true}`), NoSchemaID},
+		{nil, NoSchemaID},
+	} {
+		id := SchemaIDOf(tc.value)
+		if id != tc.expected {
+			t.Errorf("SchemaIDOf(%v): expected %d, got %d", tc.value, tc.expected, id)
+		}
+	}
+}
+
+// TestSchemaIDMonitor tests schema id appearance and disappearance tracking
+func TestSchemaIDMonitor(t *testing.T) {
+	_, err := NewSchemaIDMonitor(0, nil)
+	if err == nil {
+		t.Errorf("Expected NewSchemaIDMonitor() with zero window to fail")
+	}
+
+	var changes []SchemaIDChange
+	m, err := NewSchemaIDMonitor(time.Minute, func(change SchemaIDChange) {
+		changes = append(changes, change)
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	topic := "orders"
+	m.Observe(&Message{TopicPartition: TopicPartition{Topic: &topic},
+		Value: []byte{0, 0, 0, 0, 1, 'a'}})
+
+	start := time.Now()
+	m.observeAt(topic, 1, start)
+	m.observeAt(topic, 2, start.Add(30*time.Second))
+	m.observeAt(topic, NoSchemaID, start.Add(40*time.Second))
+	m.observeAt("other", 1, start.Add(40*time.Second))
+
+	stats := m.SchemaIDs(topic)
+	if len(stats) != 3 || stats[0].SchemaID != NoSchemaID ||
+		stats[1].SchemaID != 1 || stats[1].Count != 2 || stats[2].SchemaID != 2 {
+		t.Errorf("Unexpected schema id distribution %v", stats)
+	}
+
+	// Schema id 1 disappears from orders, but not from other
+	m.sweepAt(start.Add(90 * time.Second))
+
+	expected := []SchemaIDChange{
+		{Topic: topic, SchemaID: 1, Appeared: true},
+		{Topic: topic, SchemaID: 2, Appeared: true},
+		{Topic: topic, SchemaID: NoSchemaID, Appeared: true},
+		{Topic: "other", SchemaID: 1, Appeared: true},
+		{Topic: topic, SchemaID: 1, Appeared: false},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+	}
+
+	for i, exp := range expected {
+		c := changes[i]
+		if c.Topic != exp.Topic || c.SchemaID != exp.SchemaID || c.Appeared != exp.Appeared {
+			t.Errorf("Change #%d: expected %v, got %v", i, exp, c)
+		}
+	}
+
+	if changes[4].Stats.Count != 2 {
+		t.Errorf("Expected disappeared schema id count 2, got %v", changes[4].Stats)
+	}
+
+	// Reappearance of schema id 1, while schema id 2 disappears
+	changes = nil
+	m.observeAt(topic, 1, start.Add(100*time.Second))
+	if len(changes) != 2 ||
+		changes[0].SchemaID != 2 || changes[0].Appeared ||
+		changes[1].SchemaID != 1 || !changes[1].Appeared || changes[1].Stats.Count != 1 {
+		t.Errorf("Expected schema id 2 to disappear and 1 to reappear, got %v", changes)
+	}
+}
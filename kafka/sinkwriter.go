@@ -0,0 +1,229 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+)
+
+// SinkStore is implemented by external systems (databases, search indexes,
+// object stores, ..) that a SinkWriter writes consumed messages to.
+//
+// For exactly-once delivery to the external system the store must persist
+// the written messages and their offsets atomically, e.g., in the same
+// database transaction, so that LastOffset always reflects what was
+// actually written.
+type SinkStore interface {
+	// LastOffset returns the offset of the last message written to the
+	// store for the given topic and partition, or OffsetInvalid if no
+	// message has been written for the partition.
+	LastOffset(topic string, partition int32) (Offset, error)
+
+	// Write atomically writes a batch of messages to the store.
+	// Messages are ordered by offset within each partition and the batch
+	// never contains a message that has already been written.
+	Write(msgs []*Message) error
+}
+
+// sinkPartition is the SinkWriter's per-partition map key.
+type sinkPartition struct {
+	topic     string
+	partition int32
+}
+
+// SinkWriter implements idempotent writes of consumed messages to an
+// external SinkStore by deduplicating messages on their
+// (topic, partition, offset) coordinates.
+//
+// Messages are buffered by Add() and written as a single batch by Flush(),
+// which then commits the consumer offsets of the written partitions.
+// Messages redelivered after a consumer restart, rebalance or failed commit,
+// that is messages at or below the last offset written to the store,
+// are dropped.
+//
+// A SinkWriter is not safe for concurrent use.
+type SinkWriter struct {
+	consumer  *Consumer
+	store     SinkStore
+	batchSize int
+	batch     []*Message
+	// last written or buffered offset per partition
+	offsets map[sinkPartition]Offset
+}
+
+// NewSinkWriter creates a new SinkWriter writing batches of at most
+// batchSize messages to store.
+//
+// If consumer is non-nil the offsets of written messages are committed
+// on the consumer after each successful write, in which case
+// `enable.auto.commit` should be set to false.
+func NewSinkWriter(consumer *Consumer, store SinkStore, batchSize int) (*SinkWriter, error) {
+	if store == nil {
+		return nil, newErrorFromString(ErrInvalidArg, "SinkStore must not be nil")
+	}
+
+	if batchSize < 1 {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid batchSize %d, must be at least 1", batchSize))
+	}
+
+	return &SinkWriter{
+		consumer:  consumer,
+		store:     store,
+		batchSize: batchSize,
+		offsets:   make(map[sinkPartition]Offset),
+	}, nil
+}
+
+// lastOffset returns the last written or buffered offset for the partition,
+// looking it up in the store if not yet known.
+func (w *SinkWriter) lastOffset(key sinkPartition) (Offset, error) {
+	offset, found := w.offsets[key]
+	if found {
+		return offset, nil
+	}
+
+	offset, err := w.store.LastOffset(key.topic, key.partition)
+	if err != nil {
+		return OffsetInvalid, err
+	}
+
+	w.offsets[key] = offset
+	return offset, nil
+}
+
+// Add buffers msg for writing to the store, unless msg has already been
+// written (or buffered) in which case it is dropped.
+// The buffered batch is written by calling Flush() once it reaches
+// the configured batch size.
+//
+// Returns true if msg was added, or false if it was a duplicate.
+func (w *SinkWriter) Add(msg *Message) (added bool, err error) {
+	if msg == nil || msg.TopicPartition.Topic == nil {
+		return false, newErrorFromString(ErrInvalidArg, "Message without topic")
+	}
+
+	if msg.TopicPartition.Error != nil {
+		return false, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Can't write errored message %v: %v",
+				msg, msg.TopicPartition.Error))
+	}
+
+	if msg.TopicPartition.Offset < 0 {
+		return false, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Can't write message %v without an absolute offset", msg))
+	}
+
+	key := sinkPartition{*msg.TopicPartition.Topic, msg.TopicPartition.Partition}
+	last, err := w.lastOffset(key)
+	if err != nil {
+		return false, err
+	}
+
+	if last >= 0 && msg.TopicPartition.Offset <= last {
+		// Already written or buffered
+		return false, nil
+	}
+
+	w.batch = append(w.batch, msg)
+	w.offsets[key] = msg.TopicPartition.Offset
+
+	if len(w.batch) >= w.batchSize {
+		return true, w.Flush()
+	}
+
+	return true, nil
+}
+
+// Len returns the number of buffered messages not yet written to the store.
+func (w *SinkWriter) Len() int {
+	return len(w.batch)
+}
+
+// Flush writes the buffered messages to the store and, if a consumer
+// was provided, commits the offsets following the written messages.
+//
+// If the store write fails the buffered messages are retained and
+// Flush() may be retried.
+// A commit failure is returned to the application but does not affect
+// correctness since redelivered messages will be deduplicated.
+func (w *SinkWriter) Flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	err := w.store.Write(w.batch)
+	if err != nil {
+		return err
+	}
+
+	// Commit the offset following the last written message
+	// for each partition in the batch.
+	commitIdx := make(map[sinkPartition]int)
+	var offsets []TopicPartition
+	for _, msg := range w.batch {
+		key := sinkPartition{*msg.TopicPartition.Topic, msg.TopicPartition.Partition}
+		i, found := commitIdx[key]
+		if !found {
+			i = len(offsets)
+			commitIdx[key] = i
+			offsets = append(offsets, TopicPartition{
+				Topic:     msg.TopicPartition.Topic,
+				Partition: msg.TopicPartition.Partition})
+		}
+		if msg.TopicPartition.Offset+1 > offsets[i].Offset {
+			offsets[i].Offset = msg.TopicPartition.Offset + 1
+		}
+	}
+
+	w.batch = nil
+
+	if w.consumer == nil {
+		return nil
+	}
+
+	_, err = w.consumer.CommitOffsets(offsets)
+	return err
+}
+
+// Forget drops buffered messages and cached offsets for the given partitions,
+// which is typically called for revoked partitions following a rebalance.
+// If the partitions are later reassigned their last written offsets
+// are looked up from the store again.
+//
+// Call Flush() prior to Forget() to write buffered messages for
+// the partitions.
+func (w *SinkWriter) Forget(partitions []TopicPartition) {
+	forget := make(map[sinkPartition]bool)
+	for _, tp := range partitions {
+		if tp.Topic == nil {
+			continue
+		}
+		key := sinkPartition{*tp.Topic, tp.Partition}
+		forget[key] = true
+		delete(w.offsets, key)
+	}
+
+	var batch []*Message
+	for _, msg := range w.batch {
+		key := sinkPartition{*msg.TopicPartition.Topic, msg.TopicPartition.Partition}
+		if !forget[key] {
+			batch = append(batch, msg)
+		}
+	}
+	w.batch = batch
+}
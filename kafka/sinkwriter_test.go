@@ -0,0 +1,129 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testSinkStore is an in-memory SinkStore
+type testSinkStore struct {
+	written []*Message
+	last    map[string]Offset
+	failErr error
+}
+
+func (s *testSinkStore) LastOffset(topic string, partition int32) (Offset, error) {
+	offset, found := s.last[fmt.Sprintf("%s[%d]", topic, partition)]
+	if !found {
+		return OffsetInvalid, nil
+	}
+	return offset, nil
+}
+
+func (s *testSinkStore) Write(msgs []*Message) error {
+	if s.failErr != nil {
+		return s.failErr
+	}
+	for _, msg := range msgs {
+		s.written = append(s.written, msg)
+		s.last[fmt.Sprintf("%s[%d]", *msg.TopicPartition.Topic, msg.TopicPartition.Partition)] = msg.TopicPartition.Offset
+	}
+	return nil
+}
+
+// TestSinkWriter tests SinkWriter deduplication, no broker is needed.
+func TestSinkWriter(t *testing.T) {
+	topic := "gotest"
+	store := &testSinkStore{last: map[string]Offset{"gotest[1]": 4}}
+
+	_, err := NewSinkWriter(nil, store, 0)
+	if err == nil {
+		t.Fatalf("Expected NewSinkWriter() to fail with batchSize 0")
+	}
+
+	w, err := NewSinkWriter(nil, store, 3)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	newMsg := func(partition int32, offset Offset) *Message {
+		return &Message{TopicPartition: TopicPartition{Topic: &topic, Partition: partition, Offset: offset}}
+	}
+
+	// Partition 1 offsets up to 4 are already in the store
+	for _, tc := range []struct {
+		msg      *Message
+		expAdded bool
+	}{
+		{newMsg(0, 0), true},
+		{newMsg(1, 3), false},
+		{newMsg(1, 4), false},
+		{newMsg(1, 5), true},
+		{newMsg(0, 0), false},
+	} {
+		added, err := w.Add(tc.msg)
+		if err != nil {
+			t.Fatalf("Add(%v) failed: %s", tc.msg, err)
+		}
+		if added != tc.expAdded {
+			t.Errorf("Add(%v): expected added %v, not %v", tc.msg, tc.expAdded, added)
+		}
+	}
+
+	if w.Len() != 2 {
+		t.Errorf("Expected 2 buffered messages, not %d", w.Len())
+	}
+
+	// Failed writes retain the batch
+	store.failErr = newErrorFromString(ErrFail, "write failed")
+	err = w.Flush()
+	if err == nil {
+		t.Errorf("Expected Flush() to fail")
+	}
+	if w.Len() != 2 {
+		t.Errorf("Expected 2 buffered messages after failed Flush(), not %d", w.Len())
+	}
+
+	store.failErr = nil
+	err = w.Flush()
+	if err != nil {
+		t.Errorf("Flush() failed: %s", err)
+	}
+	if w.Len() != 0 || len(store.written) != 2 {
+		t.Errorf("Expected 0 buffered and 2 written messages, not %d and %d",
+			w.Len(), len(store.written))
+	}
+
+	// Forgotten partitions are reloaded from the store
+	w.Add(newMsg(2, 10))
+	w.Forget([]TopicPartition{{Topic: &topic, Partition: 2}})
+	if w.Len() != 0 {
+		t.Errorf("Expected Forget() to drop buffered message, %d remain", w.Len())
+	}
+
+	added, _ := w.Add(newMsg(2, 10))
+	if !added {
+		t.Errorf("Expected unwritten message to be added after Forget()")
+	}
+
+	_, err = w.Add(&Message{TopicPartition: TopicPartition{Topic: &topic, Offset: OffsetEnd}})
+	if err == nil {
+		t.Errorf("Expected Add() to fail for logical offset")
+	}
+}
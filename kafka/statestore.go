@@ -0,0 +1,432 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyValueStore is a local key-value state store used by Topology
+// processing steps, see Topology.AddStore().
+//
+// Implementations may be in-memory, see NewMemoryKeyValueStore(),
+// or persistent, e.g., adapting an embedded key-value database.
+type KeyValueStore interface {
+	// Get returns the value of key, and whether key was found.
+	Get(key []byte) (value []byte, found bool, err error)
+	// Put sets the value of key.
+	Put(key []byte, value []byte) error
+	// Delete deletes key, if present.
+	Delete(key []byte) error
+	// Range calls fn in key order for each key in the range [from, to),
+	// a nil from or to leaves the range open at that end.
+	// Iteration stops if fn returns false.
+	// fn must not modify the store.
+	Range(from []byte, to []byte, fn func(key []byte, value []byte) bool) error
+	// Close releases the store's resources.
+	Close() error
+}
+
+// memoryKeyValueStore is an in-memory KeyValueStore
+type memoryKeyValueStore struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryKeyValueStore creates a new empty in-memory KeyValueStore.
+// The store is safe for concurrent use.
+func NewMemoryKeyValueStore() KeyValueStore {
+	return &memoryKeyValueStore{data: make(map[string][]byte)}
+}
+
+// Get implements KeyValueStore
+func (s *memoryKeyValueStore) Get(key []byte) ([]byte, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	value, found := s.data[string(key)]
+	return value, found, nil
+}
+
+// Put implements KeyValueStore
+func (s *memoryKeyValueStore) Put(key []byte, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data[string(key)] = value
+	return nil
+}
+
+// Delete implements KeyValueStore
+func (s *memoryKeyValueStore) Delete(key []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+// Range implements KeyValueStore
+func (s *memoryKeyValueStore) Range(from []byte, to []byte, fn func(key []byte, value []byte) bool) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if from != nil && key < string(from) {
+			continue
+		}
+		if to != nil && key >= string(to) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !fn([]byte(key), s.data[key]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Close implements KeyValueStore
+func (s *memoryKeyValueStore) Close() error {
+	return nil
+}
+
+// WindowStore stores values per key and fixed-size, non-overlapping,
+// time window on top of a KeyValueStore, e.g., for windowed aggregations.
+type WindowStore struct {
+	store      KeyValueStore
+	windowSize time.Duration
+}
+
+// NewWindowStore creates a new WindowStore of windowSize windows
+// stored in store.
+func NewWindowStore(store KeyValueStore, windowSize time.Duration) (*WindowStore, error) {
+	if windowSize < time.Millisecond {
+		return nil, newErrorFromString(ErrInvalidArg, "Window size must be at least 1ms")
+	}
+
+	return &WindowStore{store: store, windowSize: windowSize}, nil
+}
+
+// WindowStart returns the start of the window containing ts.
+func (w *WindowStore) WindowStart(ts time.Time) time.Time {
+	sizeMs := int64(w.windowSize / time.Millisecond)
+	ms := ts.UnixNano() / int64(time.Millisecond)
+	start := ms - ms%sizeMs
+	if ms < 0 && ms%sizeMs != 0 {
+		start -= sizeMs
+	}
+	return time.Unix(0, start*int64(time.Millisecond))
+}
+
+// windowKey encodes key and windowStart as a store key that orders
+// by key and then by window start:
+// 4-byte key length, key, 8-byte order-preserving window start in ms.
+func windowKey(key []byte, windowStart time.Time) []byte {
+	wkey := make([]byte, 4+len(key)+8)
+	binary.BigEndian.PutUint32(wkey, uint32(len(key)))
+	copy(wkey[4:], key)
+	ms := windowStart.UnixNano() / int64(time.Millisecond)
+	binary.BigEndian.PutUint64(wkey[4+len(key):], uint64(ms)^(1<<63))
+	return wkey
+}
+
+// parseWindowKey decodes a store key encoded by windowKey()
+func parseWindowKey(wkey []byte) (key []byte, windowStart time.Time, ok bool) {
+	if len(wkey) < 12 {
+		return nil, time.Time{}, false
+	}
+	keyLen := int(binary.BigEndian.Uint32(wkey))
+	if len(wkey) != 4+keyLen+8 {
+		return nil, time.Time{}, false
+	}
+	ms := int64(binary.BigEndian.Uint64(wkey[4+keyLen:]) ^ (1 << 63))
+	return wkey[4 : 4+keyLen], time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// Put sets the value of key for the window containing ts.
+func (w *WindowStore) Put(key []byte, ts time.Time, value []byte) error {
+	return w.store.Put(windowKey(key, w.WindowStart(ts)), value)
+}
+
+// Get returns the value of key for the window containing ts,
+// and whether it was found.
+func (w *WindowStore) Get(key []byte, ts time.Time) ([]byte, bool, error) {
+	return w.store.Get(windowKey(key, w.WindowStart(ts)))
+}
+
+// Fetch calls fn, in window order, for each window of key starting
+// in the time range [from, to).
+// Iteration stops if fn returns false.
+func (w *WindowStore) Fetch(key []byte, from time.Time, to time.Time, fn func(windowStart time.Time, value []byte) bool) error {
+	return w.store.Range(windowKey(key, w.WindowStart(from)), windowKey(key, to),
+		func(wkey []byte, value []byte) bool {
+			_, windowStart, ok := parseWindowKey(wkey)
+			if !ok || windowStart.Before(from) {
+				return true
+			}
+			return fn(windowStart, value)
+		})
+}
+
+// Expire deletes all windows, of all keys, that end before the given time,
+// enforcing the store's retention.
+func (w *WindowStore) Expire(before time.Time) error {
+	var expired [][]byte
+
+	err := w.store.Range(nil, nil, func(wkey []byte, value []byte) bool {
+		_, windowStart, ok := parseWindowKey(wkey)
+		if ok && !windowStart.Add(w.windowSize).After(before) {
+			expired = append(expired, append([]byte(nil), wkey...))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, wkey := range expired {
+		err = w.store.Delete(wkey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changelogStore is a KeyValueStore logging all modifications, so that
+// the store can be restored from the log.
+type changelogStore struct {
+	KeyValueStore
+	log func(key []byte, value []byte) error
+}
+
+// Put implements KeyValueStore
+func (s *changelogStore) Put(key []byte, value []byte) error {
+	err := s.KeyValueStore.Put(key, value)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		// Keep nil for tombstones only
+		value = []byte{}
+	}
+	return s.log(key, value)
+}
+
+// Delete implements KeyValueStore
+func (s *changelogStore) Delete(key []byte) error {
+	err := s.KeyValueStore.Delete(key)
+	if err != nil {
+		return err
+	}
+	return s.log(key, nil)
+}
+
+// restoreStore restores store from partition of the changelog topic,
+// reading it from the beginning to its end.
+// A non-existent changelog restores nothing.
+func restoreStore(ctx context.Context, conf *ConfigMap, store KeyValueStore, topic string, partition int32) error {
+	r, err := NewPartitionReader(conf, topic, partition, OffsetBeginning)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		msg, err := r.ReadMessage(ctx)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			if kerr, ok := err.(Error); ok &&
+				(kerr.Code() == ErrUnknownTopicOrPart ||
+					kerr.Code() == ErrUnknownTopic ||
+					kerr.Code() == ErrUnknownPartition) {
+				return nil
+			}
+			return err
+		}
+
+		if msg.Value == nil {
+			err = store.Delete(msg.Key)
+		} else {
+			err = store.Put(msg.Key, msg.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// storeSpec is a state store added to a Topology
+type storeSpec struct {
+	changelogTopic string
+	factory        func() KeyValueStore
+}
+
+// AddStore adds a KeyValueStore named name to the topology, with one store
+// instance, created by factory, per assigned source partition number.
+// Records from source topics with the same partition number share the
+// store instance (co-partitioning).
+//
+// If changelogTopic is not empty all store modifications are produced
+// to the same partition of changelogTopic, which should be compacted and
+// have at least as many partitions as the source topics, and store
+// instances are restored from it when partitions are assigned.
+// Changelog messages are delivered before the offset of the message whose
+// processing modified the store is committed.
+//
+// Store instances are restored from the rebalance callback, which blocks
+// consumption until the changelog partitions of all newly assigned
+// partitions have been read, each with its own PartitionReader consumer.
+// Restoring must complete within the consumer's `max.poll.interval.ms`,
+// which bounds the size of changelogs: keep them compacted.
+//
+// Only NewMemoryKeyValueStore() is provided. Persistent stores, e.g.,
+// adapting pebble or RocksDB, are left to the application's factory,
+// keeping this package free of such dependencies.
+//
+// Stores are accessed by processing steps with Store().
+func (t *Topology) AddStore(name string, changelogTopic string, factory func() KeyValueStore) {
+	if _, found := t.stores[name]; found && t.err == nil {
+		t.err = newErrorFromString(ErrInvalidArg, "Store "+name+" added more than once")
+	}
+
+	t.stores[name] = &storeSpec{changelogTopic: changelogTopic, factory: factory}
+	if changelogTopic != "" {
+		t.needsProducer = true
+	}
+}
+
+// Store returns the instance of the store named name for the source
+// partition of r.
+// Must only be called from processing steps while the topology is running.
+func (t *Topology) Store(name string, r Record) (KeyValueStore, error) {
+	if r.Source == nil {
+		return nil, newErrorFromString(ErrInvalidArg, "Record without source message")
+	}
+
+	partition := r.Source.TopicPartition.Partition
+	store, found := t.storeInstances[name][partition]
+	if !found {
+		if _, found = t.stores[name]; !found {
+			return nil, newErrorFromString(ErrInvalidArg, "Unknown store "+name)
+		}
+		return nil, newErrorFromString(ErrState,
+			"Store "+name+" is not available for the record's partition")
+	}
+
+	return store, nil
+}
+
+// openStores creates, and restores from their changelogs, the store
+// instances of the given partitions, if not already open.
+//
+// Store instances are restored concurrently, each reading its changelog
+// partition with a PartitionReader, since this is called from the
+// rebalance callback which blocks the consumer until all are restored.
+func (t *Topology) openStores(ctx context.Context, partitions []TopicPartition) error {
+	type opened struct {
+		name      string
+		partition int32
+		store     KeyValueStore
+		err       error
+	}
+
+	var wg sync.WaitGroup
+	var results []*opened
+
+	for name, spec := range t.stores {
+		instances, found := t.storeInstances[name]
+		if !found {
+			instances = make(map[int32]KeyValueStore)
+			t.storeInstances[name] = instances
+		}
+
+		for _, tp := range partitions {
+			if _, found = instances[tp.Partition]; found {
+				continue
+			}
+
+			o := &opened{name: name, partition: tp.Partition, store: spec.factory()}
+			results = append(results, o)
+
+			if spec.changelogTopic == "" {
+				continue
+			}
+
+			wg.Add(1)
+			go func(o *opened, changelogTopic string) {
+				defer wg.Done()
+				o.err = restoreStore(ctx, t.consumerConf, o.store, changelogTopic, o.partition)
+				if o.err == nil {
+					o.store = t.newChangelogStore(o.store, changelogTopic, o.partition)
+				}
+			}(o, spec.changelogTopic)
+		}
+	}
+
+	wg.Wait()
+
+	var err error
+	for _, o := range results {
+		if o.err != nil {
+			if err == nil {
+				err = o.err
+			}
+			o.store.Close()
+			continue
+		}
+		t.storeInstances[o.name][o.partition] = o.store
+	}
+
+	return err
+}
+
+// newChangelogStore returns store logging to partition of changelogTopic
+func (t *Topology) newChangelogStore(store KeyValueStore, changelogTopic string, partition int32) KeyValueStore {
+	return &changelogStore{
+		KeyValueStore: store,
+		log: func(key []byte, value []byte) error {
+			return t.send(&Message{
+				TopicPartition: TopicPartition{Topic: &changelogTopic, Partition: partition},
+				Key:            key,
+				Value:          value,
+			})
+		},
+	}
+}
+
+// closeStores closes all store instances
+func (t *Topology) closeStores() {
+	for name, instances := range t.storeInstances {
+		for _, store := range instances {
+			store.Close()
+		}
+		delete(t.storeInstances, name)
+	}
+}
@@ -0,0 +1,224 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestMemoryKeyValueStore tests the in-memory KeyValueStore
+func TestMemoryKeyValueStore(t *testing.T) {
+	store := NewMemoryKeyValueStore()
+	defer store.Close()
+
+	for _, k := range []string{"c", "a", "d", "b"} {
+		store.Put([]byte(k), []byte("v"+k))
+	}
+	store.Delete([]byte("d"))
+
+	value, found, err := store.Get([]byte("a"))
+	if err != nil || !found || string(value) != "va" {
+		t.Errorf("Expected a=va, got %s, %v, %v", value, found, err)
+	}
+
+	_, found, _ = store.Get([]byte("d"))
+	if found {
+		t.Errorf("Expected deleted key d not to be found")
+	}
+
+	var keys string
+	store.Range([]byte("b"), nil, func(key []byte, value []byte) bool {
+		keys += string(key)
+		return true
+	})
+	if keys != "bc" {
+		t.Errorf("Expected range [b, ) to be bc, got %s", keys)
+	}
+
+	keys = ""
+	store.Range(nil, []byte("c"), func(key []byte, value []byte) bool {
+		keys += string(key)
+		return len(keys) < 1
+	})
+	if keys != "a" {
+		t.Errorf("Expected range [, c) stopped after a, got %s", keys)
+	}
+}
+
+// TestWindowStore tests windowed storage on a KeyValueStore
+func TestWindowStore(t *testing.T) {
+	_, err := NewWindowStore(NewMemoryKeyValueStore(), 0)
+	if err == nil {
+		t.Errorf("Expected NewWindowStore() with zero window size to fail")
+	}
+
+	w, err := NewWindowStore(NewMemoryKeyValueStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	base := time.Unix(1500000000, 0) // a whole minute
+	if !w.WindowStart(base.Add(59 * time.Second)).Equal(base) {
+		t.Errorf("Unexpected window start %v for %v", w.WindowStart(base.Add(59*time.Second)), base)
+	}
+
+	for i := 0; i < 5; i++ {
+		w.Put([]byte("k"), base.Add(time.Duration(i)*time.Minute+time.Second), []byte(strconv.Itoa(i)))
+		w.Put([]byte("k2"), base.Add(time.Duration(i)*time.Minute), []byte("other"))
+	}
+
+	value, found, _ := w.Get([]byte("k"), base.Add(2*time.Minute+30*time.Second))
+	if !found || string(value) != "2" {
+		t.Errorf("Expected window 2 value, got %s, %v", value, found)
+	}
+
+	var values string
+	w.Fetch([]byte("k"), base.Add(time.Minute), base.Add(4*time.Minute),
+		func(windowStart time.Time, value []byte) bool {
+			values += string(value)
+			return true
+		})
+	if values != "123" {
+		t.Errorf("Expected windows 123, got %s", values)
+	}
+
+	// Windows 0 and 1 end before 2 minutes
+	w.Expire(base.Add(2 * time.Minute))
+
+	values = ""
+	w.Fetch([]byte("k"), base, base.Add(10*time.Minute),
+		func(windowStart time.Time, value []byte) bool {
+			values += string(value)
+			return true
+		})
+	if values != "234" {
+		t.Errorf("Expected windows 234 after expiry, got %s", values)
+	}
+}
+
+// TestTopologyStore tests changelogged Topology stores, no broker is needed.
+func TestTopologyStore(t *testing.T) {
+	topo := NewTopology()
+	topo.AddStore("counts", "counts-changelog", NewMemoryKeyValueStore)
+
+	var storeErr error
+	topo.Source("in", StringSerde, StringSerde).ForEach(func(r Record) error {
+		store, err := topo.Store("counts", r)
+		if err != nil {
+			storeErr = err
+			return err
+		}
+
+		key := []byte(r.Key.(string))
+		value, _, _ := store.Get(key)
+		cnt, _ := strconv.Atoi(string(value))
+		return store.Put(key, []byte(strconv.Itoa(cnt+1)))
+	})
+
+	var produced []*Message
+	topo.produce = func(msg *Message, deliveryChan chan Event) error {
+		produced = append(produced, msg)
+		return nil
+	}
+	topo.deliveryChan = make(chan Event, 10)
+
+	in := "in"
+	msg := &Message{TopicPartition: TopicPartition{Topic: &in, Partition: 3}, Key: []byte("k")}
+
+	// Store not open for partition
+	err := topo.process(msg)
+	if err == nil || storeErr == nil {
+		t.Errorf("Expected processing to fail for unassigned store partition")
+	}
+	// Run() would stop on the processing error, discard its pending offset.
+	topo.pending = make(map[string][]*pendingOffset)
+
+	// Unknown store
+	_, err = topo.Store("unknown", Record{Source: msg})
+	if err == nil {
+		t.Errorf("Expected Store() of unknown store to fail")
+	}
+
+	// Open the partition's store without restoring from the changelog
+	store := NewMemoryKeyValueStore()
+	topo.storeInstances["counts"] = map[int32]KeyValueStore{
+		3: topo.newChangelogStore(store, "counts-changelog", 3),
+	}
+
+	for i := 0; i < 2; i++ {
+		err = topo.process(msg)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	value, _, _ := store.Get([]byte("k"))
+	if string(value) != "2" {
+		t.Errorf("Expected count 2, got %s", value)
+	}
+
+	if len(produced) != 2 || *produced[1].TopicPartition.Topic != "counts-changelog" ||
+		produced[1].TopicPartition.Partition != 3 || string(produced[1].Value) != "2" {
+		t.Errorf("Unexpected changelog messages %v", produced)
+	}
+
+	if offsets := topo.completedOffsets(); len(offsets) != 0 {
+		t.Errorf("Expected no committable offsets before changelog delivery, got %v", offsets)
+	}
+
+	topo.closeStores()
+	if len(topo.storeInstances) != 0 {
+		t.Errorf("Expected stores to be closed")
+	}
+}
+
+// TestTopologyOpenStores tests opening store instances for assigned
+// partitions, with changelog restores failing without a broker.
+func TestTopologyOpenStores(t *testing.T) {
+	topo := NewTopology()
+	topo.AddStore("plain", "", NewMemoryKeyValueStore)
+	topo.AddStore("logged", "logged-changelog", NewMemoryKeyValueStore)
+	topo.consumerConf = &ConfigMap{"socket.timeout.ms": 10}
+
+	topic := "in"
+	partitions := []TopicPartition{{Topic: &topic, Partition: 0}, {Topic: &topic, Partition: 1}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := topo.openStores(ctx, partitions)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected restores to time out, got %v", err)
+	}
+	// Restores run concurrently
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Expected restores to time out after ~200ms, not %v", time.Since(start))
+	}
+
+	if len(topo.storeInstances["plain"]) != 2 {
+		t.Errorf("Expected 2 plain store instances, got %v", topo.storeInstances["plain"])
+	}
+	if len(topo.storeInstances["logged"]) != 0 {
+		t.Errorf("Expected no unrestored store instances, got %v", topo.storeInstances["logged"])
+	}
+
+	topo.closeStores()
+}
@@ -0,0 +1,396 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TopicConfigChange is a change of a topic configuration entry.
+type TopicConfigChange struct {
+	// Name of configuration entry.
+	Name string
+	// CurrentValue is the entry's current value, which may be a default.
+	CurrentValue string
+	// Value is the desired value.
+	Value string
+}
+
+// String returns a human-readable representation of a TopicConfigChange.
+func (c TopicConfigChange) String() string {
+	return fmt.Sprintf("%s: \"%s\" -> \"%s\"", c.Name, c.CurrentValue, c.Value)
+}
+
+// TopicPlan is the difference between a topic's desired specification
+// and its current state, see AdminClient.PlanTopics().
+type TopicPlan struct {
+	// Spec is the desired topic specification.
+	Spec TopicSpecification
+	// Create is true if the topic does not exist and is to be created
+	// from Spec.
+	Create bool
+	// CurrentPartitions is the topic's current partition count,
+	// 0 if the topic does not exist.
+	CurrentPartitions int
+	// IncreasePartitionsTo is the partition count to increase the topic
+	// to, 0 if unchanged.
+	IncreasePartitionsTo int
+	// ConfigChanges are the configuration entries to change,
+	// sorted by name. Changes may be removed before applying the plan.
+	ConfigChanges []TopicConfigChange
+	// CurrentConfig is the topic's current dynamic configuration
+	// (overrides) by name, excluding sensitive entries whose values
+	// can't be described. Entries not changed by ConfigChanges are kept
+	// when applying the plan, see ApplyTopicPlans().
+	// Plans with ConfigChanges must have a non-nil CurrentConfig.
+	CurrentConfig map[string]string
+	// Warnings describe desired changes that can't be applied, such as
+	// decreasing the partition count or changing the replication factor.
+	Warnings []string
+}
+
+// HasChanges returns true if applying the plan modifies the topic.
+func (p TopicPlan) HasChanges() bool {
+	return p.Create || p.IncreasePartitionsTo > 0 || len(p.ConfigChanges) > 0
+}
+
+// String returns a human-readable representation of a TopicPlan.
+func (p TopicPlan) String() string {
+	var changes []string
+
+	if p.Create {
+		changes = append(changes, fmt.Sprintf("create with %d partitions", p.Spec.NumPartitions))
+	}
+	if p.IncreasePartitionsTo > 0 {
+		changes = append(changes, fmt.Sprintf("increase partitions %d -> %d",
+			p.CurrentPartitions, p.IncreasePartitionsTo))
+	}
+	for _, c := range p.ConfigChanges {
+		changes = append(changes, c.String())
+	}
+	for _, w := range p.Warnings {
+		changes = append(changes, "warning: "+w)
+	}
+
+	if len(changes) == 0 {
+		return fmt.Sprintf("%s: no changes", p.Spec.Topic)
+	}
+	return fmt.Sprintf("%s: %s", p.Spec.Topic, strings.Join(changes, ", "))
+}
+
+// topicPlanner plans and applies topic changes with pluggable cluster
+// requests, allowing it to be tested without a broker.
+type topicPlanner struct {
+	getMetadata      func(topic *string, allTopics bool, timeoutMs int) (*Metadata, error)
+	describeConfigs  func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error)
+	createTopics     func(ctx context.Context, topics []TopicSpecification) ([]TopicResult, error)
+	createPartitions func(ctx context.Context, partitions []PartitionsSpecification) ([]TopicResult, error)
+	alterConfigs     func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error)
+}
+
+// topicPlanner returns a topicPlanner for the cluster of a
+func (a *AdminClient) topicPlanner() topicPlanner {
+	return topicPlanner{
+		getMetadata: a.GetMetadata,
+		describeConfigs: func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error) {
+			return a.DescribeConfigs(ctx, resources)
+		},
+		createTopics: func(ctx context.Context, topics []TopicSpecification) ([]TopicResult, error) {
+			return a.CreateTopics(ctx, topics)
+		},
+		createPartitions: func(ctx context.Context, partitions []PartitionsSpecification) ([]TopicResult, error) {
+			return a.CreatePartitions(ctx, partitions)
+		},
+		alterConfigs: func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error) {
+			return a.AlterConfigs(ctx, resources)
+		},
+	}
+}
+
+// PlanTopics compares the desired topic specifications to the topics'
+// current partition counts and configuration, returning a plan per topic
+// that ApplyTopicPlans() applies, e.g., to declaratively manage topics
+// from specifications kept under version control.
+//
+// A topic that does not exist is planned to be created. Otherwise
+// a NumPartitions higher than the current partition count is planned as
+// a partition increase, and configuration entries in Config that differ
+// from the current values are planned as changes. A zero NumPartitions
+// leaves the partition count unchanged, and configuration entries not in
+// Config are left unchanged.
+//
+// timeoutMs is the maximum time of each metadata request.
+func (a *AdminClient) PlanTopics(ctx context.Context, topics []TopicSpecification, timeoutMs int) ([]TopicPlan, error) {
+	return a.topicPlanner().plan(ctx, topics, timeoutMs)
+}
+
+// ApplyTopicPlans applies plans returned by PlanTopics(), creating topics,
+// increasing partition counts and altering configurations, and returns
+// a result per plan with changes.
+//
+// Configurations are altered with AlterConfigs(), since incremental
+// configuration updates (IncrementalAlterConfigs) are not supported by the
+// minimum required librdkafka version. AlterConfigs() replaces a topic's
+// entire configuration, so each topic's CurrentConfig is applied along
+// with its ConfigChanges: topics modified since they were planned should
+// be planned again, as configuration entries changed in between are
+// reverted. For the same reason, configuration changes are not planned
+// for topics with sensitive overrides, whose values can't be described,
+// unless the desired configuration includes them.
+//
+// An ErrInvalidArg error is returned, before any change is applied, if
+// a plan has ConfigChanges but no CurrentConfig.
+//
+// Changes are non-atomic and may succeed for some topics but fail for
+// others, make sure to check the result for topic-specific errors.
+func (a *AdminClient) ApplyTopicPlans(ctx context.Context, plans []TopicPlan) ([]TopicResult, error) {
+	return a.topicPlanner().apply(ctx, plans)
+}
+
+// plan implements PlanTopics()
+func (tp topicPlanner) plan(ctx context.Context, topics []TopicSpecification, timeoutMs int) ([]TopicPlan, error) {
+	plans := make([]TopicPlan, len(topics))
+
+	for i, spec := range topics {
+		topic := spec.Topic
+		md, err := tp.getMetadata(&topic, false, timeoutMs)
+		if err != nil {
+			return nil, err
+		}
+
+		plan := TopicPlan{Spec: spec}
+
+		tmd, found := md.Topics[topic]
+		if !found || tmd.Error.Code() == ErrUnknownTopicOrPart ||
+			tmd.Error.Code() == ErrUnknownTopic {
+			plan.Create = true
+			plans[i] = plan
+			continue
+		}
+		if tmd.Error.Code() != ErrNoError {
+			return nil, tmd.Error
+		}
+
+		plan.CurrentPartitions = len(tmd.Partitions)
+		if spec.NumPartitions > plan.CurrentPartitions {
+			plan.IncreasePartitionsTo = spec.NumPartitions
+		} else if spec.NumPartitions > 0 && spec.NumPartitions < plan.CurrentPartitions {
+			plan.Warnings = append(plan.Warnings,
+				fmt.Sprintf("partition count can't be decreased from %d to %d",
+					plan.CurrentPartitions, spec.NumPartitions))
+		}
+
+		if spec.ReplicationFactor > 0 && len(tmd.Partitions) > 0 &&
+			len(tmd.Partitions[0].Replicas) != spec.ReplicationFactor {
+			plan.Warnings = append(plan.Warnings,
+				fmt.Sprintf("replication factor can't be changed from %d to %d",
+					len(tmd.Partitions[0].Replicas), spec.ReplicationFactor))
+		}
+
+		if len(spec.Config) > 0 {
+			err = tp.planConfig(ctx, &plan)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		plans[i] = plan
+	}
+
+	return plans, nil
+}
+
+// planConfig plans the configuration changes of an existing topic
+func (tp topicPlanner) planConfig(ctx context.Context, plan *TopicPlan) error {
+	results, err := tp.describeConfigs(ctx, []ConfigResource{{Type: ResourceTopic, Name: plan.Spec.Topic}})
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 {
+		return newErrorFromString(ErrFail,
+			fmt.Sprintf("Expected 1 config result for topic %s, got %d", plan.Spec.Topic, len(results)))
+	}
+	if results[0].Error.Code() != ErrNoError {
+		return results[0].Error
+	}
+
+	current := results[0].Config
+
+	names := make([]string, 0, len(plan.Spec.Config))
+	for name := range plan.Spec.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := plan.Spec.Config[name]
+		entry, found := current[name]
+		if found && entry.IsReadOnly {
+			plan.Warnings = append(plan.Warnings,
+				fmt.Sprintf("%s is read-only", name))
+			continue
+		}
+		// Sensitive values are not returned, and are always set
+		if found && !entry.IsSensitive && entry.Value == value {
+			continue
+		}
+		plan.ConfigChanges = append(plan.ConfigChanges,
+			TopicConfigChange{Name: name, CurrentValue: entry.Value, Value: value})
+	}
+
+	// Keep the topic's current overrides when applying the plan.
+	// Sensitive values are not returned and can't be kept: rather than
+	// reverting them, the configuration changes are not planned.
+	plan.CurrentConfig = make(map[string]string)
+	var sensitive []string
+	for name, entry := range current {
+		if entry.Source != ConfigSourceDynamicTopic || entry.IsSynonym {
+			continue
+		}
+		if entry.IsSensitive {
+			if _, found := plan.Spec.Config[name]; !found {
+				sensitive = append(sensitive, name)
+			}
+			continue
+		}
+		plan.CurrentConfig[name] = entry.Value
+	}
+
+	if len(sensitive) > 0 && len(plan.ConfigChanges) > 0 {
+		sort.Strings(sensitive)
+		plan.Warnings = append(plan.Warnings,
+			fmt.Sprintf("configuration can't be changed without reverting sensitive entries %s, "+
+				"include them in the desired configuration", strings.Join(sensitive, ", ")))
+		plan.ConfigChanges = nil
+	}
+
+	return nil
+}
+
+// alterConfig returns the topic's full dynamic configuration once
+// changed, since AlterConfigs() reverts entries not provided to their
+// defaults.
+func (p TopicPlan) alterConfig() []ConfigEntry {
+	config := make(map[string]string, len(p.CurrentConfig)+len(p.ConfigChanges))
+	for name, value := range p.CurrentConfig {
+		config[name] = value
+	}
+	for _, c := range p.ConfigChanges {
+		config[c.Name] = c.Value
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]ConfigEntry, len(names))
+	for i, name := range names {
+		entries[i] = ConfigEntry{Name: name, Value: config[name], Operation: AlterOperationSet}
+	}
+
+	return entries
+}
+
+// apply implements ApplyTopicPlans()
+func (tp topicPlanner) apply(ctx context.Context, plans []TopicPlan) ([]TopicResult, error) {
+	var creates []TopicSpecification
+	var partitions []PartitionsSpecification
+	var resources []ConfigResource
+
+	// Result per topic with changes, in plan order
+	var result []TopicResult
+	index := make(map[string]int)
+
+	for _, plan := range plans {
+		if !plan.Create && len(plan.ConfigChanges) > 0 && plan.CurrentConfig == nil {
+			return nil, newErrorFromString(ErrInvalidArg,
+				fmt.Sprintf("Plan for topic %s has configuration changes but no current configuration, "+
+					"which would be reverted", plan.Spec.Topic))
+		}
+	}
+
+	for _, plan := range plans {
+		if !plan.HasChanges() {
+			continue
+		}
+		index[plan.Spec.Topic] = len(result)
+		result = append(result, TopicResult{Topic: plan.Spec.Topic})
+
+		if plan.Create {
+			creates = append(creates, plan.Spec)
+			continue
+		}
+		if plan.IncreasePartitionsTo > 0 {
+			partitions = append(partitions, PartitionsSpecification{
+				Topic:      plan.Spec.Topic,
+				IncreaseTo: plan.IncreasePartitionsTo,
+			})
+		}
+		if len(plan.ConfigChanges) > 0 {
+			resources = append(resources, ConfigResource{
+				Type:   ResourceTopic,
+				Name:   plan.Spec.Topic,
+				Config: plan.alterConfig(),
+			})
+		}
+	}
+
+	// setError records the first error of each topic
+	setError := func(topic string, err Error) {
+		i, found := index[topic]
+		if found && err.Code() != ErrNoError && result[i].Error.Code() == ErrNoError {
+			result[i].Error = err
+		}
+	}
+
+	if len(creates) > 0 {
+		res, err := tp.createTopics(ctx, creates)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range res {
+			setError(r.Topic, r.Error)
+		}
+	}
+
+	if len(partitions) > 0 {
+		res, err := tp.createPartitions(ctx, partitions)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range res {
+			setError(r.Topic, r.Error)
+		}
+	}
+
+	if len(resources) > 0 {
+		res, err := tp.alterConfigs(ctx, resources)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range res {
+			setError(r.Name, r.Error)
+		}
+	}
+
+	return result, nil
+}
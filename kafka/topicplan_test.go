@@ -0,0 +1,248 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+// TestTopicPlan tests planning and applying topic changes against
+// a fake cluster, no broker is needed.
+func TestTopicPlan(t *testing.T) {
+	var created []TopicSpecification
+	var increased []PartitionsSpecification
+	var altered []ConfigResource
+
+	tp := topicPlanner{
+		getMetadata: func(topic *string, allTopics bool, timeoutMs int) (*Metadata, error) {
+			md := &Metadata{Topics: make(map[string]TopicMetadata)}
+			if *topic == "existing" || *topic == "unchanged" {
+				md.Topics[*topic] = TopicMetadata{Topic: *topic, Partitions: []PartitionMetadata{
+					{ID: 0, Replicas: []int32{1, 2}},
+					{ID: 1, Replicas: []int32{2, 1}},
+				}}
+			} else {
+				md.Topics[*topic] = TopicMetadata{Topic: *topic,
+					Error: newErrorFromString(ErrUnknownTopicOrPart, "Unknown topic")}
+			}
+			return md, nil
+		},
+		describeConfigs: func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error) {
+			return []ConfigResourceResult{{
+				Type: ResourceTopic,
+				Name: resources[0].Name,
+				Config: map[string]ConfigEntryResult{
+					"cleanup.policy":      {Name: "cleanup.policy", Value: "delete", Source: ConfigSourceDefault},
+					"retention.ms":        {Name: "retention.ms", Value: "3600000", Source: ConfigSourceDynamicTopic},
+					"min.insync.replicas": {Name: "min.insync.replicas", Value: "2", Source: ConfigSourceDynamicTopic},
+				},
+			}}, nil
+		},
+		createTopics: func(ctx context.Context, topics []TopicSpecification) ([]TopicResult, error) {
+			created = append(created, topics...)
+			return []TopicResult{{Topic: topics[0].Topic}}, nil
+		},
+		createPartitions: func(ctx context.Context, partitions []PartitionsSpecification) ([]TopicResult, error) {
+			increased = append(increased, partitions...)
+			return []TopicResult{{Topic: partitions[0].Topic}}, nil
+		},
+		alterConfigs: func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error) {
+			altered = append(altered, resources...)
+			return []ConfigResourceResult{{Type: ResourceTopic, Name: resources[0].Name,
+				Error: newErrorFromString(ErrPolicyViolation, "Policy violation")}}, nil
+		},
+	}
+
+	plans, err := tp.plan(context.Background(), []TopicSpecification{
+		{Topic: "new", NumPartitions: 3, ReplicationFactor: 2},
+		{Topic: "existing", NumPartitions: 4, ReplicationFactor: 3,
+			Config: map[string]string{"cleanup.policy": "compact", "retention.ms": "3600000"}},
+		{Topic: "unchanged", NumPartitions: 1,
+			Config: map[string]string{"min.insync.replicas": "2"}},
+	}, 100)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(plans) != 3 {
+		t.Fatalf("Expected 3 plans, got %d", len(plans))
+	}
+
+	t.Logf("Plans: %v", plans)
+
+	if !plans[0].Create || !plans[0].HasChanges() {
+		t.Errorf("Expected topic new to be created: %v", plans[0])
+	}
+
+	existing := plans[1]
+	if existing.Create || existing.CurrentPartitions != 2 || existing.IncreasePartitionsTo != 4 {
+		t.Errorf("Expected partition increase 2 -> 4: %v", existing)
+	}
+	if len(existing.ConfigChanges) != 1 ||
+		existing.ConfigChanges[0] != (TopicConfigChange{"cleanup.policy", "delete", "compact"}) {
+		t.Errorf("Expected cleanup.policy change only: %v", existing.ConfigChanges)
+	}
+	if len(existing.Warnings) != 1 {
+		t.Errorf("Expected replication factor warning: %v", existing.Warnings)
+	}
+
+	unchanged := plans[2]
+	if unchanged.HasChanges() || len(unchanged.Warnings) != 1 {
+		t.Errorf("Expected no changes and partition decrease warning: %v", unchanged)
+	}
+
+	results, err := tp.apply(context.Background(), plans)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if len(results) != 2 || results[0].Topic != "new" || results[1].Topic != "existing" {
+		t.Fatalf("Expected results for new and existing, got %v", results)
+	}
+	if results[0].Error.Code() != ErrNoError {
+		t.Errorf("Expected new to succeed: %v", results[0])
+	}
+	if results[1].Error.Code() != ErrPolicyViolation {
+		t.Errorf("Expected existing to fail with policy violation: %v", results[1])
+	}
+
+	if len(created) != 1 || created[0].Topic != "new" {
+		t.Errorf("Expected topic new to be created: %v", created)
+	}
+	if len(increased) != 1 || increased[0].IncreaseTo != 4 {
+		t.Errorf("Expected existing to be increased to 4 partitions: %v", increased)
+	}
+
+	// The current override of min.insync.replicas must be kept,
+	// since AlterConfigs() reverts entries not provided.
+	if len(altered) != 1 {
+		t.Fatalf("Expected 1 altered resource, got %v", altered)
+	}
+	var entries []string
+	for _, e := range altered[0].Config {
+		entries = append(entries, e.Name+"="+e.Value)
+	}
+	sort.Strings(entries)
+	expected := []string{"cleanup.policy=compact", "min.insync.replicas=2", "retention.ms=3600000"}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected config %v, got %v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Expected config %v, got %v", expected, entries)
+			break
+		}
+	}
+}
+
+// TestTopicPlanSensitive tests that configuration changes are not planned
+// when sensitive overrides would be reverted, no broker is needed.
+func TestTopicPlanSensitive(t *testing.T) {
+	tp := topicPlanner{
+		describeConfigs: func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error) {
+			return []ConfigResourceResult{{
+				Type: ResourceTopic,
+				Name: resources[0].Name,
+				Config: map[string]ConfigEntryResult{
+					"retention.ms": {Name: "retention.ms", Value: "3600000", Source: ConfigSourceDynamicTopic},
+					"secret":       {Name: "secret", Source: ConfigSourceDynamicTopic, IsSensitive: true},
+				},
+			}}, nil
+		},
+	}
+
+	plan := TopicPlan{Spec: TopicSpecification{Topic: "gotest",
+		Config: map[string]string{"retention.ms": "60000"}}}
+	err := tp.planConfig(context.Background(), &plan)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if plan.HasChanges() || len(plan.Warnings) != 1 {
+		t.Errorf("Expected sensitive entry warning without changes: %v", plan)
+	}
+
+	// Desired sensitive values are set
+	plan = TopicPlan{Spec: TopicSpecification{Topic: "gotest",
+		Config: map[string]string{"retention.ms": "60000", "secret": "s3cr3t"}}}
+	err = tp.planConfig(context.Background(), &plan)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(plan.ConfigChanges) != 2 || len(plan.alterConfig()) != 2 || len(plan.Warnings) != 0 {
+		t.Errorf("Expected changes of retention.ms and secret: %v", plan)
+	}
+}
+
+// TestTopicPlanModified tests applying plans whose configuration changes
+// were modified after planning, no broker is needed.
+func TestTopicPlanModified(t *testing.T) {
+	var altered []ConfigResource
+
+	tp := topicPlanner{
+		alterConfigs: func(ctx context.Context, resources []ConfigResource) ([]ConfigResourceResult, error) {
+			altered = append(altered, resources...)
+			return []ConfigResourceResult{{Type: ResourceTopic, Name: resources[0].Name}}, nil
+		},
+	}
+
+	plan := TopicPlan{
+		Spec: TopicSpecification{Topic: "gotest",
+			Config: map[string]string{"retention.ms": "60000", "cleanup.policy": "compact"}},
+		ConfigChanges: []TopicConfigChange{
+			{Name: "cleanup.policy", CurrentValue: "delete", Value: "compact"},
+			{Name: "retention.ms", CurrentValue: "3600000", Value: "60000"},
+		},
+		CurrentConfig: map[string]string{"retention.ms": "3600000", "min.insync.replicas": "2"},
+	}
+
+	// Filtered changes are not applied and the current values are kept
+	plan.ConfigChanges = plan.ConfigChanges[:1]
+	_, err := tp.apply(context.Background(), []TopicPlan{plan})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(altered) != 1 {
+		t.Fatalf("Expected 1 altered resource, got %v", altered)
+	}
+	expected := []ConfigEntry{
+		{Name: "cleanup.policy", Value: "compact"},
+		{Name: "min.insync.replicas", Value: "2"},
+		{Name: "retention.ms", Value: "3600000"},
+	}
+	if len(altered[0].Config) != len(expected) {
+		t.Fatalf("Expected config %v, got %v", expected, altered[0].Config)
+	}
+	for i := range expected {
+		if altered[0].Config[i] != expected[i] {
+			t.Errorf("Expected config %v, got %v", expected, altered[0].Config)
+			break
+		}
+	}
+
+	// Plans without the current configuration would revert it
+	plan.CurrentConfig = nil
+	altered = nil
+	_, err = tp.apply(context.Background(), []TopicPlan{plan})
+	if err == nil || err.(Error).Code() != ErrInvalidArg {
+		t.Errorf("Expected ErrInvalidArg for plan without current configuration, got %v", err)
+	}
+	if len(altered) != 0 {
+		t.Errorf("Expected no altered resources, got %v", altered)
+	}
+}
@@ -0,0 +1,637 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Serde serializes and deserializes Record keys or values
+// to and from their Kafka message representation.
+type Serde interface {
+	// Serialize returns the serialized form of v for topic.
+	Serialize(topic string, v interface{}) ([]byte, error)
+	// Deserialize returns the deserialized form of data from topic.
+	Deserialize(topic string, data []byte) (interface{}, error)
+}
+
+// bytesSerde passes []byte unmodified
+type bytesSerde struct{}
+
+func (s bytesSerde) Serialize(topic string, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("BytesSerde can't serialize %T", v))
+	}
+	return b, nil
+}
+
+func (s bytesSerde) Deserialize(topic string, data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// stringSerde converts between string and []byte
+type stringSerde struct{}
+
+func (s stringSerde) Serialize(topic string, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	str, ok := v.(string)
+	if !ok {
+		return nil, newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("StringSerde can't serialize %T", v))
+	}
+	return []byte(str), nil
+}
+
+func (s stringSerde) Deserialize(topic string, data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return string(data), nil
+}
+
+// jsonSerde converts between Go values and JSON
+type jsonSerde struct{}
+
+func (s jsonSerde) Serialize(topic string, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func (s jsonSerde) Deserialize(topic string, data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+var (
+	// BytesSerde passes []byte keys and values unmodified.
+	BytesSerde Serde = bytesSerde{}
+	// StringSerde (de)serializes string keys and values.
+	StringSerde Serde = stringSerde{}
+	// JSONSerde (de)serializes keys and values as JSON,
+	// deserialized values are of the types used by encoding/json
+	// for interface{} values.
+	JSONSerde Serde = jsonSerde{}
+)
+
+// Record is the unit of data flowing through a Topology.
+type Record struct {
+	// Key is the deserialized key.
+	Key interface{}
+	// Value is the deserialized value.
+	Value interface{}
+	// Headers are the message headers, produced as-is by sinks.
+	Headers []Header
+	// Timestamp is the message timestamp, produced as-is by sinks.
+	Timestamp time.Time
+	// Source is the consumed message the record derives from.
+	Source *Message
+}
+
+// topologyNode is a processing step of a Topology
+type topologyNode struct {
+	// process processes r, forwarding results to the node's
+	// children with forward.
+	process  func(r Record, forward func(r Record) error) error
+	children []*topologyNode
+}
+
+// run processes r through n and its descendants
+func (n *topologyNode) run(r Record) error {
+	return n.process(r, n.forward)
+}
+
+// forward passes r to all children of n
+func (n *topologyNode) forward(r Record) error {
+	for _, child := range n.children {
+		err := child.run(r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream is a sequence of Records in a Topology, to which processing
+// steps are added.
+type Stream struct {
+	topology *Topology
+	node     *topologyNode
+}
+
+// add adds a child node with process to s and returns the child's Stream
+func (s *Stream) add(process func(r Record, forward func(r Record) error) error) *Stream {
+	child := &topologyNode{process: process}
+	s.node.children = append(s.node.children, child)
+	return &Stream{topology: s.topology, node: child}
+}
+
+// Map returns a Stream of the records of s transformed by mapper.
+func (s *Stream) Map(mapper func(r Record) (Record, error)) *Stream {
+	return s.add(func(r Record, forward func(r Record) error) error {
+		mapped, err := mapper(r)
+		if err != nil {
+			return err
+		}
+		return forward(mapped)
+	})
+}
+
+// Filter returns a Stream of the records of s for which predicate is true.
+func (s *Stream) Filter(predicate func(r Record) bool) *Stream {
+	return s.add(func(r Record, forward func(r Record) error) error {
+		if !predicate(r) {
+			return nil
+		}
+		return forward(r)
+	})
+}
+
+// Branch returns one Stream per predicate, each record of s is passed to
+// the Stream of the first predicate that is true for it, if any,
+// else it is dropped.
+func (s *Stream) Branch(predicates ...func(r Record) bool) []*Stream {
+	branches := make([]*Stream, len(predicates))
+	branchNodes := make([]*topologyNode, len(predicates))
+	for i := range predicates {
+		branchNodes[i] = &topologyNode{
+			process: func(r Record, forward func(r Record) error) error {
+				return forward(r)
+			},
+		}
+		branches[i] = &Stream{topology: s.topology, node: branchNodes[i]}
+	}
+
+	s.add(func(r Record, forward func(r Record) error) error {
+		for i, predicate := range predicates {
+			if predicate(r) {
+				return branchNodes[i].run(r)
+			}
+		}
+		return nil
+	})
+
+	return branches
+}
+
+// ForEach calls action for each record of s.
+func (s *Stream) ForEach(action func(r Record) error) {
+	s.add(func(r Record, forward func(r Record) error) error {
+		return action(r)
+	})
+}
+
+// Sink produces the records of s to topic, serializing their key and value
+// with keySerde and valueSerde.
+func (s *Stream) Sink(topic string, keySerde Serde, valueSerde Serde) {
+	t := s.topology
+	t.needsProducer = true
+	s.add(func(r Record, forward func(r Record) error) error {
+		return t.sink(topic, keySerde, valueSerde, r)
+	})
+}
+
+// pendingOffset is a consumed message whose offset is stored once all
+// the records produced by processing it have been delivered.
+type pendingOffset struct {
+	tp        TopicPartition
+	processed bool
+	remaining int
+}
+
+// Topology is a lightweight stream processing topology of source topics,
+// processing steps (map, filter, branch, for-each) and sink topics, run on
+// a Consumer and Producer. Processing steps may keep local state in
+// changelog-backed state stores, see AddStore().
+//
+// Offsets of consumed messages are committed once the message has been
+// processed and all records produced by its processing have been delivered,
+// providing at-least-once processing.
+//
+// A Topology is built with Source() and the Stream methods and
+// then run with Run(). A Topology is not safe for concurrent use.
+type Topology struct {
+	sources       map[string]*topologyNode
+	serdes        map[string][2]Serde
+	stores        map[string]*storeSpec
+	needsProducer bool
+	err           error
+
+	// Run state
+	runCtx       context.Context
+	consumerConf *ConfigMap
+	consumer     *Consumer
+	// store name -> partition -> store instance
+	storeInstances map[string]map[int32]KeyValueStore
+	produce        func(msg *Message, deliveryChan chan Event) error
+	deliveryChan   chan Event
+	// offset pending for the record being processed
+	current *pendingOffset
+	// "topic\x00partition" -> pending offsets in consumed order
+	pending      map[string][]*pendingOffset
+	outstanding  int
+	rebalanceErr error
+}
+
+// NewTopology creates a new empty Topology.
+func NewTopology() *Topology {
+	return &Topology{
+		sources:        make(map[string]*topologyNode),
+		serdes:         make(map[string][2]Serde),
+		stores:         make(map[string]*storeSpec),
+		storeInstances: make(map[string]map[int32]KeyValueStore),
+		pending:        make(map[string][]*pendingOffset),
+	}
+}
+
+// Source returns a Stream of the records consumed from topic, deserializing
+// message keys and values with keySerde and valueSerde.
+func (t *Topology) Source(topic string, keySerde Serde, valueSerde Serde) *Stream {
+	if _, found := t.sources[topic]; found && t.err == nil {
+		t.err = newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Topic %s used as source more than once", topic))
+	}
+
+	node := &topologyNode{
+		process: func(r Record, forward func(r Record) error) error {
+			return forward(r)
+		},
+	}
+	t.sources[topic] = node
+	t.serdes[topic] = [2]Serde{keySerde, valueSerde}
+
+	return &Stream{topology: t, node: node}
+}
+
+// process processes the consumed message msg through its topic's source.
+func (t *Topology) process(msg *Message) error {
+	topic := *msg.TopicPartition.Topic
+	source, found := t.sources[topic]
+	if !found {
+		return newErrorFromString(ErrUnknownTopic,
+			fmt.Sprintf("Message from topic %s without a source", topic))
+	}
+
+	serdes := t.serdes[topic]
+	key, err := serdes[0].Deserialize(topic, msg.Key)
+	if err != nil {
+		return err
+	}
+	value, err := serdes[1].Deserialize(topic, msg.Value)
+	if err != nil {
+		return err
+	}
+
+	po := &pendingOffset{tp: msg.TopicPartition}
+	partKey := fmt.Sprintf("%s\x00%d", topic, msg.TopicPartition.Partition)
+	t.pending[partKey] = append(t.pending[partKey], po)
+
+	t.current = po
+	err = source.run(Record{Key: key, Value: value, Headers: msg.Headers,
+		Timestamp: msg.Timestamp, Source: msg})
+	t.current = nil
+	if err != nil {
+		return err
+	}
+
+	po.processed = true
+
+	return nil
+}
+
+// sink serializes and produces r to topic
+func (t *Topology) sink(topic string, keySerde Serde, valueSerde Serde, r Record) error {
+	key, err := keySerde.Serialize(topic, r.Key)
+	if err != nil {
+		return err
+	}
+	value, err := valueSerde.Serialize(topic, r.Value)
+	if err != nil {
+		return err
+	}
+
+	return t.send(&Message{
+		TopicPartition: TopicPartition{Topic: &topic, Partition: PartitionAny},
+		Key:            key,
+		Value:          value,
+		Headers:        r.Headers,
+		Timestamp:      r.Timestamp,
+	})
+}
+
+// send produces msg on behalf of the record being processed, whose offset
+// is not committed until msg is delivered.
+func (t *Topology) send(msg *Message) error {
+	if t.current == nil {
+		return newErrorFromString(ErrState,
+			"Topology messages can only be produced while processing a record")
+	}
+
+	msg.Opaque = t.current
+
+	for {
+		err := t.produce(msg, t.deliveryChan)
+		if err == nil {
+			break
+		}
+
+		if kerr, ok := err.(Error); !ok || kerr.Code() != ErrQueueFull {
+			return err
+		}
+
+		// Producer queue is full: wait for a delivery report.
+		err = t.awaitDelivery(100 * time.Millisecond)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.current.remaining++
+	t.outstanding++
+
+	return nil
+}
+
+// handleDelivery handles the delivery report of a sink message
+func (t *Topology) handleDelivery(ev Event) error {
+	msg, ok := ev.(*Message)
+	if !ok {
+		return nil
+	}
+
+	t.outstanding--
+
+	if msg.TopicPartition.Error != nil {
+		return msg.TopicPartition.Error
+	}
+
+	if po, ok := msg.Opaque.(*pendingOffset); ok {
+		po.remaining--
+	}
+
+	return nil
+}
+
+// awaitDelivery handles a delivery report, if one arrives within timeout
+func (t *Topology) awaitDelivery(timeout time.Duration) error {
+	select {
+	case ev := <-t.deliveryChan:
+		return t.handleDelivery(ev)
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// pollDeliveries handles all available delivery reports without blocking
+func (t *Topology) pollDeliveries() error {
+	for {
+		select {
+		case ev := <-t.deliveryChan:
+			err := t.handleDelivery(ev)
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// flush waits for the delivery reports of all outstanding sink messages,
+// which are guaranteed to arrive within `message.timeout.ms`.
+func (t *Topology) flush() error {
+	for t.outstanding > 0 {
+		err := t.awaitDelivery(100 * time.Millisecond)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completedOffsets returns, and removes, the offsets to commit for the
+// completed prefixes of the pending offsets of each partition.
+func (t *Topology) completedOffsets() []TopicPartition {
+	var offsets []TopicPartition
+
+	for partKey, pending := range t.pending {
+		completed := 0
+		for completed < len(pending) &&
+			pending[completed].processed && pending[completed].remaining == 0 {
+			completed++
+		}
+
+		if completed == 0 {
+			continue
+		}
+
+		tp := pending[completed-1].tp
+		tp.Offset++
+		offsets = append(offsets, tp)
+
+		if completed == len(pending) {
+			delete(t.pending, partKey)
+		} else {
+			t.pending[partKey] = pending[completed:]
+		}
+	}
+
+	return offsets
+}
+
+// storeOffsets stores the completed offsets for commit
+func (t *Topology) storeOffsets() error {
+	offsets := t.completedOffsets()
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	_, err := t.consumer.StoreOffsets(offsets)
+	return err
+}
+
+// rebalance opens the stores of assigned partitions, and completes all
+// outstanding processing and commits its offsets before partitions
+// are revoked.
+func (t *Topology) rebalance(c *Consumer, ev Event) error {
+	if assigned, ok := ev.(AssignedPartitions); ok {
+		return t.openStores(t.runCtx, assigned.Partitions)
+	}
+
+	if _, ok := ev.(RevokedPartitions); !ok {
+		return nil
+	}
+
+	err := t.flush()
+	if err == nil {
+		err = t.storeOffsets()
+	}
+	if err != nil {
+		return err
+	}
+
+	// Pending offsets and stores of revoked partitions are now irrelevant
+	t.pending = make(map[string][]*pendingOffset)
+	t.closeStores()
+
+	// ErrNoOffset if there was nothing to commit
+	c.Commit()
+
+	return nil
+}
+
+// rebalanceCb is the Consumer's rebalance callback, which can't return
+// errors to the application: the error is retained for Run().
+func (t *Topology) rebalanceCb(c *Consumer, ev Event) error {
+	err := t.rebalance(c, ev)
+	if err != nil && t.rebalanceErr == nil {
+		t.rebalanceErr = err
+	}
+	return err
+}
+
+// Run runs the topology until ctx is done or an error occurs.
+//
+// consumerConf must contain at least `bootstrap.servers` and `group.id`,
+// `enable.auto.offset.store` is disabled since offsets are stored by the
+// topology, and `enable.auto.commit` is enabled since the stored offsets
+// are committed by the auto commit interval and when closing.
+// producerConf must contain at least `bootstrap.servers` and is only
+// used if the topology has sinks or changelogged stores.
+//
+// On return, outstanding sink messages are flushed and the offsets of
+// completely processed messages are committed.
+// Returns nil if ctx is done, else the processing, serde or client error
+// that stopped the topology.
+func (t *Topology) Run(ctx context.Context, consumerConf *ConfigMap, producerConf *ConfigMap) (err error) {
+	if t.err != nil {
+		return t.err
+	}
+
+	if len(t.sources) == 0 {
+		return newErrorFromString(ErrInvalidArg, "Topology has no sources")
+	}
+
+	if t.needsProducer {
+		if producerConf == nil {
+			return newErrorFromString(ErrInvalidArg,
+				"Topology with sinks or changelogs requires a producer configuration")
+		}
+
+		pConf := producerConf.clone()
+		pConf.SetKey("go.delivery.reports", true)
+
+		p, err := NewProducer(&pConf)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		t.produce = p.Produce
+		t.deliveryChan = make(chan Event, 10000)
+	}
+
+	cConf := consumerConf.clone()
+	cConf.SetKey("enable.auto.offset.store", false)
+	cConf.SetKey("enable.auto.commit", true)
+	cConf.SetKey("go.events.channel.enable", false)
+
+	c, err := NewConsumer(&cConf)
+	if err != nil {
+		return err
+	}
+	t.consumer = c
+	t.consumerConf = consumerConf
+	t.runCtx = ctx
+
+	defer func() {
+		flushErr := t.flush()
+		if flushErr == nil {
+			flushErr = t.storeOffsets()
+		}
+		if err == nil {
+			err = flushErr
+		}
+		c.Close()
+		t.consumer = nil
+		t.closeStores()
+	}()
+
+	topics := make([]string, 0, len(t.sources))
+	for topic := range t.sources {
+		topics = append(topics, topic)
+	}
+
+	err = c.SubscribeTopics(topics, t.rebalanceCb)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		msg, err := c.ReadMessage(100 * time.Millisecond)
+		if t.rebalanceErr != nil {
+			return t.rebalanceErr
+		}
+		if err != nil {
+			if kerr, ok := err.(Error); ok && msg == nil && !kerr.IsFatal() {
+				// Timeout or transient client error
+				err = nil
+			} else {
+				return err
+			}
+		}
+
+		if msg != nil {
+			err = t.process(msg)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = t.pollDeliveries()
+		if err == nil {
+			err = t.storeOffsets()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
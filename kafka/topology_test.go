@@ -0,0 +1,179 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSerdes tests the builtin serdes
+func TestSerdes(t *testing.T) {
+	for _, tc := range []struct {
+		serde Serde
+		value interface{}
+		data  string
+	}{
+		{BytesSerde, []byte("raw"), "raw"},
+		{StringSerde, "str", "str"},
+		{JSONSerde, map[string]interface{}{"a": 1.0}, `{"a":1}`},
+	} {
+		data, err := tc.serde.Serialize("topic", tc.value)
+		if err != nil || string(data) != tc.data {
+			t.Errorf("%T: expected %s, got %s (%v)", tc.serde, tc.data, data, err)
+		}
+
+		v, err := tc.serde.Deserialize("topic", data)
+		if err != nil {
+			t.Errorf("%T: %s", tc.serde, err)
+		}
+		reserialized, _ := tc.serde.Serialize("topic", v)
+		if string(reserialized) != tc.data {
+			t.Errorf("%T: round-trip mismatch: %s != %s", tc.serde, reserialized, tc.data)
+		}
+
+		v, err = tc.serde.Deserialize("topic", nil)
+		if v != nil || err != nil {
+			t.Errorf("%T: expected nil to deserialize to nil, got %v (%v)", tc.serde, v, err)
+		}
+	}
+
+	_, err := StringSerde.Serialize("topic", 123)
+	if err == nil {
+		t.Errorf("Expected StringSerde to fail to serialize int")
+	}
+}
+
+// TestTopologyProcess tests record processing and offset management
+// of a Topology, no broker is needed.
+func TestTopologyProcess(t *testing.T) {
+	topo := NewTopology()
+
+	var logged []string
+	branches := topo.Source("in", StringSerde, StringSerde).
+		Filter(func(r Record) bool { return r.Value != "drop" }).
+		Map(func(r Record) (Record, error) {
+			r.Value = strings.ToUpper(r.Value.(string))
+			return r, nil
+		}).
+		Branch(
+			func(r Record) bool { return r.Key == "log" },
+			func(r Record) bool { return true })
+	branches[0].ForEach(func(r Record) error {
+		logged = append(logged, r.Value.(string))
+		return nil
+	})
+	branches[1].Sink("out", StringSerde, StringSerde)
+
+	var produced []*Message
+	topo.produce = func(msg *Message, deliveryChan chan Event) error {
+		produced = append(produced, msg)
+		return nil
+	}
+	topo.deliveryChan = make(chan Event, 10)
+
+	in := "in"
+	msgs := []*Message{
+		{Key: []byte("log"), Value: []byte("a")},
+		{Key: []byte("k"), Value: []byte("b")},
+		{Key: []byte("k"), Value: []byte("drop")},
+		{Key: []byte("k"), Value: []byte("c")},
+	}
+	for i, msg := range msgs {
+		msg.TopicPartition = TopicPartition{Topic: &in, Partition: 0, Offset: Offset(10 + i)}
+		err := topo.process(msg)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	if len(logged) != 1 || logged[0] != "A" {
+		t.Errorf("Expected [A] to be logged, got %v", logged)
+	}
+
+	if len(produced) != 2 || string(produced[0].Value) != "B" || string(produced[1].Value) != "C" ||
+		*produced[0].TopicPartition.Topic != "out" {
+		t.Errorf("Expected B and C to be produced to out, got %v", produced)
+	}
+
+	// Only the first message is complete until B is delivered
+	offsets := topo.completedOffsets()
+	if len(offsets) != 1 || offsets[0].Offset != 11 {
+		t.Errorf("Expected offset 11 to be committable, got %v", offsets)
+	}
+
+	// Deliver B: offsets up to and including the dropped message
+	// are complete.
+	topo.deliveryChan <- produced[0]
+	err := topo.pollDeliveries()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	offsets = topo.completedOffsets()
+	if len(offsets) != 1 || offsets[0].Offset != 13 {
+		t.Errorf("Expected offset 13 to be committable, got %v", offsets)
+	}
+
+	// Failed delivery of C
+	failed := *produced[1]
+	failed.TopicPartition.Error = newErrorFromString(ErrMsgTimedOut, "Message timed out")
+	topo.deliveryChan <- &failed
+	err = topo.flush()
+	if err == nil {
+		t.Errorf("Expected flush() to fail on delivery error")
+	}
+
+	if offsets = topo.completedOffsets(); len(offsets) != 0 {
+		t.Errorf("Expected no committable offsets after failed delivery, got %v", offsets)
+	}
+}
+
+// TestTopologyRun tests Topology validation and Run(), no broker is needed.
+func TestTopologyRun(t *testing.T) {
+	conf := &ConfigMap{"group.id": "gotest", "socket.timeout.ms": 10}
+
+	err := NewTopology().Run(context.Background(), conf, nil)
+	if err == nil {
+		t.Errorf("Expected Run() of empty topology to fail")
+	}
+
+	topo := NewTopology()
+	topo.Source("in", BytesSerde, BytesSerde)
+	topo.Source("in", BytesSerde, BytesSerde)
+	err = topo.Run(context.Background(), conf, nil)
+	if err == nil {
+		t.Errorf("Expected Run() of topology with duplicate source to fail")
+	}
+
+	topo = NewTopology()
+	topo.Source("in", BytesSerde, BytesSerde).Sink("out", BytesSerde, BytesSerde)
+	err = topo.Run(context.Background(), conf, nil)
+	if err == nil {
+		t.Errorf("Expected Run() of topology with sinks but no producer config to fail")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err = topo.Run(ctx, conf, &ConfigMap{"socket.timeout.ms": 10})
+	if err != nil {
+		t.Errorf("Expected Run() to return nil on context done, got %v", err)
+	}
+}
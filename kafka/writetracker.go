@@ -0,0 +1,251 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WriteTracker captures the offsets of produced messages from their
+// delivery reports to provide read-your-writes semantics, such as
+// waiting for a downstream consumer group to consume past the tracked
+// writes, or seeking a consumer past the application's own writes.
+//
+// WriteTracker is safe for concurrent use.
+type WriteTracker struct {
+	lock sync.Mutex
+	// end offset (last delivered offset + 1) per topic and partition
+	ends map[string]map[int32]Offset
+}
+
+// NewWriteTracker creates a new WriteTracker with no tracked writes.
+func NewWriteTracker() *WriteTracker {
+	return &WriteTracker{ends: make(map[string]map[int32]Offset)}
+}
+
+// Track records the offset of a delivery report message.
+// Failed deliveries are ignored.
+func (w *WriteTracker) Track(msg *Message) {
+	if msg == nil || msg.TopicPartition.Topic == nil ||
+		msg.TopicPartition.Error != nil || msg.TopicPartition.Offset < 0 {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	topic := *msg.TopicPartition.Topic
+	partitions, found := w.ends[topic]
+	if !found {
+		partitions = make(map[int32]Offset)
+		w.ends[topic] = partitions
+	}
+
+	end := msg.TopicPartition.Offset + 1
+	if end > partitions[msg.TopicPartition.Partition] {
+		partitions[msg.TopicPartition.Partition] = end
+	}
+}
+
+// Produce produces msgs on p and waits for all their delivery reports,
+// tracking the offset of each delivered message.
+//
+// Returns the first produce or delivery error encountered, if any,
+// or ErrTimedOut if not all delivery reports were received within timeout.
+// Messages delivered prior to an error are still tracked.
+func (w *WriteTracker) Produce(p *Producer, msgs []*Message, timeout time.Duration) error {
+	deliveryChan := make(chan Event, len(msgs))
+
+	var firstErr error
+	outstanding := 0
+	for _, msg := range msgs {
+		err := p.Produce(msg, deliveryChan)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		outstanding++
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for outstanding > 0 {
+		select {
+		case ev := <-deliveryChan:
+			m, ok := ev.(*Message)
+			if !ok {
+				continue
+			}
+			outstanding--
+			if m.TopicPartition.Error != nil {
+				if firstErr == nil {
+					firstErr = m.TopicPartition.Error
+				}
+				continue
+			}
+			w.Track(m)
+
+		case <-timer.C:
+			if firstErr == nil {
+				firstErr = newErrorFromString(ErrTimedOut,
+					fmt.Sprintf("Timed out waiting for %d delivery report(s)", outstanding))
+			}
+			return firstErr
+		}
+	}
+
+	return firstErr
+}
+
+// Offsets returns the tracked end offsets, that is the offset following
+// the last delivered message, for each written topic partition.
+// The returned list is sorted by topic and partition.
+func (w *WriteTracker) Offsets() []TopicPartition {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var offsets TopicPartitions
+	for topic, partitions := range w.ends {
+		// Each TopicPartition needs its own topic pointer
+		for partition, end := range partitions {
+			t := topic
+			offsets = append(offsets, TopicPartition{Topic: &t, Partition: partition, Offset: end})
+		}
+	}
+
+	sort.Sort(offsets)
+
+	return offsets
+}
+
+// Reset forgets all tracked writes.
+func (w *WriteTracker) Reset() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.ends = make(map[string]map[int32]Offset)
+}
+
+// remaining returns the tracked offsets that are not yet covered by
+// the given committed offsets.
+func (w *WriteTracker) remaining(committed []TopicPartition) []TopicPartition {
+	var remain []TopicPartition
+
+	offsets := w.Offsets()
+	for _, tp := range offsets {
+		done := false
+		for _, ctp := range committed {
+			if ctp.Topic != nil && *ctp.Topic == *tp.Topic &&
+				ctp.Partition == tp.Partition && ctp.Offset >= tp.Offset {
+				done = true
+				break
+			}
+		}
+		if !done {
+			remain = append(remain, tp)
+		}
+	}
+
+	return remain
+}
+
+// WaitUntilConsumed blocks until consumer group groupID has committed
+// offsets past all tracked writes, or ctx is done.
+//
+// conf is used to create a temporary, non-subscribing, consumer instance
+// for looking up the group's committed offsets, its `group.id`
+// is overridden by groupID.
+// The committed offsets are checked every pollInterval, which must be
+// positive.
+func (w *WriteTracker) WaitUntilConsumed(ctx context.Context, conf *ConfigMap, groupID string, pollInterval time.Duration) error {
+	if pollInterval <= 0 {
+		return newErrorFromString(ErrInvalidArg,
+			fmt.Sprintf("Invalid poll interval %v, must be positive", pollInterval))
+	}
+
+	confCopy := conf.clone()
+	confCopy.SetKey("group.id", groupID)
+	confCopy.SetKey("enable.auto.commit", false)
+
+	c, err := NewConsumer(&confCopy)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		remain := w.remaining(nil)
+		if len(remain) == 0 {
+			return nil
+		}
+
+		timeoutMs := durationToMilliseconds(pollInterval)
+		if timeoutMs < 1000 {
+			timeoutMs = 1000
+		}
+
+		committed, err := c.Committed(remain, timeoutMs)
+		if err == nil && len(w.remaining(committed)) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// SeekPastWrites seeks consumer c past the tracked writes for all
+// tracked partitions currently assigned to c, so that the consumer
+// skips the application's own writes.
+//
+// Returns the partitions that were seeked.
+func (w *WriteTracker) SeekPastWrites(c *Consumer, timeoutMs int) ([]TopicPartition, error) {
+	assignment, err := c.Assignment()
+	if err != nil {
+		return nil, err
+	}
+
+	var seeked []TopicPartition
+	for _, tp := range w.Offsets() {
+		for _, atp := range assignment {
+			if *atp.Topic != *tp.Topic || atp.Partition != tp.Partition {
+				continue
+			}
+			err = c.Seek(tp, timeoutMs)
+			if err != nil {
+				return seeked, err
+			}
+			seeked = append(seeked, tp)
+			break
+		}
+	}
+
+	return seeked, nil
+}
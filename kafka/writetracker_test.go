@@ -0,0 +1,88 @@
+/**
+ * Copyright 2019 Confluent Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestWriteTracker tests WriteTracker offset tracking, no broker is needed.
+func TestWriteTracker(t *testing.T) {
+	topic1 := "gotest1"
+	topic2 := "gotest2"
+
+	w := NewWriteTracker()
+
+	w.Track(&Message{TopicPartition: TopicPartition{Topic: &topic2, Partition: 0, Offset: 7}})
+	w.Track(&Message{TopicPartition: TopicPartition{Topic: &topic1, Partition: 1, Offset: 10}})
+	w.Track(&Message{TopicPartition: TopicPartition{Topic: &topic1, Partition: 1, Offset: 3}})
+	w.Track(&Message{TopicPartition: TopicPartition{Topic: &topic1, Partition: 0, Offset: 5,
+		Error: newErrorFromString(ErrMsgTimedOut, "failed")}})
+
+	offsets := w.Offsets()
+	expected := "[gotest1[1]@11 gotest2[0]@8]"
+	if fmt.Sprintf("%v", offsets) != expected {
+		t.Errorf("Expected offsets %s, not %v", expected, offsets)
+	}
+
+	remain := w.remaining([]TopicPartition{
+		{Topic: &topic1, Partition: 1, Offset: 11},
+		{Topic: &topic2, Partition: 0, Offset: 7}})
+	if len(remain) != 1 || *remain[0].Topic != topic2 {
+		t.Errorf("Expected %s to remain, not %v", topic2, remain)
+	}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := w.WaitUntilConsumed(context.Background(), &ConfigMap{}, "gotest", interval)
+		if err == nil || err.(Error).Code() != ErrInvalidArg {
+			t.Errorf("Expected ErrInvalidArg for poll interval %v, got %v", interval, err)
+		}
+	}
+
+	w.Reset()
+	if len(w.Offsets()) != 0 {
+		t.Errorf("Expected no offsets after Reset(), not %v", w.Offsets())
+	}
+}
+
+// TestWriteTrackerProduce tests WriteTracker.Produce() with failing deliveries.
+func TestWriteTrackerProduce(t *testing.T) {
+	p, err := NewProducer(&ConfigMap{
+		"socket.timeout.ms":  10,
+		"message.timeout.ms": 10})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer p.Close()
+
+	topic := "gotest"
+	w := NewWriteTracker()
+	err = w.Produce(p, []*Message{
+		{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}, Value: []byte("one")},
+		{TopicPartition: TopicPartition{Topic: &topic, Partition: 0}, Value: []byte("two")}},
+		5*time.Second)
+	if err == nil {
+		t.Errorf("Expected Produce() to fail without a broker")
+	}
+
+	if len(w.Offsets()) != 0 {
+		t.Errorf("Expected no tracked offsets, not %v", w.Offsets())
+	}
+}